@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/migrations"
+)
+
+// autoMigrate applies the migrations compiled into the binary, it returns the number of applied ones.
+// The provider holds an advisory lock, so replicas started at once do not apply them twice.
+func autoMigrate(ctx context.Context, cfg config.DBConf) (int, error) {
+	db, err := sql.Open("pgx", cfg.CollectDsn())
+	if err != nil {
+		return 0, err
+	}
+	provider, err := migrations.NewProvider(db)
+	if err != nil {
+		return 0, errors.Join(err, db.Close())
+	}
+	results, err := provider.Up(ctx)
+	return len(results), errors.Join(err, provider.Close())
+}
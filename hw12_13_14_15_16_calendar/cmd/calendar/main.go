@@ -3,26 +3,34 @@ package main
 import (
 	"context"
 	"flag"
+	"io"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	_ "github.com/jackc/pgx/stdlib"
-	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/health"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/logger"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/mapper"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/reload"
 	internalhttp "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/server"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/service"
-	memorystorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/memory"
-	sqlstorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/sql"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/backend"
+	cachestorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/cache"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/tracing"
 )
 
-var configFile string
+var (
+	configFile     string
+	migrateOnStart bool
+)
 
 func init() {
 	flag.StringVar(&configFile, "config", "./configs/calendar_config.yaml", "Path to configuration file")
+	flag.BoolVar(&migrateOnStart, "auto-migrate", false, "Apply the postgres migrations before start")
 }
 
 func main() {
@@ -34,35 +42,67 @@ func main() {
 	}
 
 	cfg := config.NewCalendarConfig(configFile)
-	level, err := zerolog.ParseLevel(cfg.Logger.Level)
-	if err != nil {
-		log.Fatal().Err(err).Msg("error while parsing log level")
+	if err := logger.Configure(cfg.Logger); err != nil {
+		log.Fatal().Err(err).Msg("failed to configure logger")
 	}
-	zerolog.SetGlobalLevel(level)
 	logg := logger.New()
 
-	var storage service.Storage
-	if cfg.DB.InMemory {
-		logg.Info("work with in-memory mod ...")
-		storage = memorystorage.New()
-	} else {
-		logg.Info("work with postgresql...")
-		sql := sqlstorage.New(cfg.DB.CollectDsn(), cfg.DB)
-		err := sql.Connect(context.Background())
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing, "calendar")
+	if err != nil {
+		logg.Fatal("failed to init tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logg.Error("failed to flush traces", err)
+		}
+	}()
+
+	checker := health.NewChecker()
+	logg.InfoWithParams("opening storage", map[string]string{"backend": backend.Name(cfg.DB)})
+	storage, err := backend.New(context.Background(), cfg.DB, logg.Component(logger.ComponentStorage))
+	if err != nil {
+		logg.Fatal("failed connect to db", err)
+	}
+	if migrateOnStart && backend.Name(cfg.DB) == config.DBDriverPostgres {
+		applied, err := autoMigrate(context.Background(), cfg.DB)
 		if err != nil {
-			logg.Fatal("failed connect to db", err)
+			logg.Fatal("failed to apply migrations", err)
 		}
-		storage = sql
+		logg.InfoWithParams("migrations applied", map[string]string{"count": strconv.Itoa(applied)})
+	}
+	if c, ok := storage.(io.Closer); ok {
+		defer func() {
+			if err := c.Close(); err != nil {
+				logg.Error("failed to close storage", err)
+			}
+		}()
+	}
+	if p, ok := storage.(backend.Pinger); ok {
+		checker.Add(backend.Name(cfg.DB), p.Ping)
 	}
 
-	eventService := service.NewEventService(storage, logg, mapper.EventMapper{})
-	app := internalhttp.NewApp(eventService)
-	server := internalhttp.NewServer(app, logg, cfg.Server)
-
-	ctx, cancel := signal.NotifyContext(context.Background(),
-		syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	if cfg.Cache.Enabled {
+		cached := cachestorage.New(storage, cfg.Cache)
+		go cached.Listen(ctx)
+		storage = cached
+	}
+
+	eventService := service.NewEventService(storage, logg.Component(logger.ComponentService), mapper.EventMapper{})
+	app := internalhttp.NewApp(eventService, checker)
+	server := internalhttp.NewServer(app, logg.Component(logger.ComponentServer), cfg.Server)
+
+	reloader := reload.New(cfg, func() (config.CalendarConfig, error) {
+		return config.LoadCalendarConfig(configFile)
+	}, func(next config.CalendarConfig) error {
+		return logger.Configure(next.Logger)
+	}, logg, "logging")
+	go reloader.WatchSIGHUP(ctx)
+
 	go func() {
 		<-ctx.Done()
 
@@ -5,36 +5,161 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	_ "github.com/jackc/pgx/stdlib"
 	"github.com/pressly/goose/v3"
 	"github.com/rs/zerolog/log"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
-	_ "github.com/timutkin/otus-go/hw12_13_14_15_calendar/migrations"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/migrations"
 )
 
-var configFile string
+const usage = `Usage: migrate [-config file] [-dir dir] <command> [args]
+
+Commands:
+  up                 apply all pending migrations (default)
+  up-to <version>    apply the pending migrations up to the version
+  down               roll back the last applied migration
+  redo               roll back the last applied migration and apply it again
+  status             print the state of every migration
+  version            print the version of the database
+  create <name>      create a migration in -dir, no database is needed
+
+Flags:
+`
+
+var (
+	configFile string
+	dir        string
+)
 
 func init() {
 	flag.StringVar(&configFile, "config", "./configs/calendar_config.yaml", "Path to configuration file")
+	flag.StringVar(&dir, "dir", "./migrations", "Directory of the migration sources, used by create")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 }
 
 func main() {
 	flag.Parse()
+	command, args := "up", flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	if command == "create" {
+		if len(args) != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		goose.SetSequential(true)
+		if err := goose.CreateWithTemplate(nil, dir, migrations.Template, args[0], "go"); err != nil {
+			log.Fatal().Err(err).Msg("failed to create migration")
+		}
+		return
+	}
 
 	cfg := config.NewCalendarConfig(configFile)
+	// sqlite applies its own migrations on start.
+	if cfg.DB.InMemory || cfg.DB.Driver != config.DBDriverPostgres {
+		log.Info().Str("backend", cfg.DB.Driver).Bool("inMemory", cfg.DB.InMemory).Msg("nothing to migrate")
+		return
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	db, err := sql.Open("pgx", cfg.DB.CollectDsn())
+	if err != nil {
+		log.Fatal().Err(err).Msg("error while connect to db")
+	}
+	defer db.Close()
+	provider, err := migrations.NewProvider(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load migrations")
+	}
 
-	if !cfg.DB.InMemory {
-		db, err := goose.OpenDBWithDriver("pgx", cfg.DB.CollectDsn())
+	if err := run(ctx, provider, command, args); err != nil {
+		log.Fatal().Err(err).Str("command", command).Msg("migrate failed")
+	}
+}
+
+func run(ctx context.Context, p *goose.Provider, command string, args []string) error {
+	switch command {
+	case "up":
+		results, err := p.Up(ctx)
+		printResults(results)
+		return err
+	case "up-to":
+		version, err := versionArg(args)
+		if err != nil {
+			return err
+		}
+		results, err := p.UpTo(ctx, version)
+		printResults(results)
+		return err
+	case "down":
+		result, err := p.Down(ctx)
+		printResults([]*goose.MigrationResult{result})
+		return err
+	case "redo":
+		result, err := p.Down(ctx)
+		printResults([]*goose.MigrationResult{result})
+		if err != nil {
+			return err
+		}
+		result, err = p.UpByOne(ctx)
+		printResults([]*goose.MigrationResult{result})
+		return err
+	case "status":
+		statuses, err := p.Status(ctx)
 		if err != nil {
-			log.Fatal().Err(err).Msg("error while connect to db")
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tSOURCE")
+		for _, s := range statuses {
+			appliedAt := "-"
+			if !s.AppliedAt.IsZero() {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Source.Version, s.State, appliedAt, s.Source.Path)
 		}
-		defer db.Close()
+		return w.Flush()
+	case "version":
+		version, err := p.GetDBVersion(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println(version)
+		return nil
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func versionArg(args []string) (int64, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected a version, got %d arguments", len(args))
+	}
+	return strconv.ParseInt(args[0], 10, 64)
+}
 
-		ctx := context.Background()
-		if err = goose.RunContext(ctx, "up", db, "."); err != nil {
-			log.Fatal().Err(err).Msg("goose run failed")
+func printResults(results []*goose.MigrationResult) {
+	for _, r := range results {
+		if r != nil {
+			fmt.Println(r)
 		}
 	}
 }
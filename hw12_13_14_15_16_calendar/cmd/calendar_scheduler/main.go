@@ -3,17 +3,24 @@ package main
 import (
 	"context"
 	"flag"
+	"io"
 	"os/signal"
 	"syscall"
+	"time"
 
 	_ "github.com/jackc/pgx/stdlib"
-	"github.com/rs/zerolog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/admin"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/client"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/health"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/leader"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/logger"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/reload"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/scheduler"
-	sqlstorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/sql"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/backend"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/tracing"
 )
 
 var configFile string
@@ -32,36 +39,136 @@ func main() {
 
 	cfg := config.NewSchedulerConfig(configFile)
 
-	level, err := zerolog.ParseLevel(cfg.Logger.Level)
-	if err != nil {
-		log.Fatal().Err(err).Msg("parsing jobs")
+	if err := logger.Configure(cfg.Logger); err != nil {
+		log.Fatal().Err(err).Msg("failed to configure logger")
 	}
-	zerolog.SetGlobalLevel(level)
 	logg := logger.New()
 
-	rabbitClient := client.NewRabbitClient(cfg.Rabbit.ConnectionString, logg)
-	s := scheduler.NewScheduler(logg)
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing, "calendar_scheduler")
+	if err != nil {
+		logg.Fatal("failed to init tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logg.Error("failed to flush traces", err)
+		}
+	}()
 
-	sql := sqlstorage.New(cfg.DB.CollectDsn(), cfg.DB)
-	err = sql.Connect(context.Background())
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	rabbitClient := client.NewRabbitClient(cfg.Rabbit, logg)
+	defer func() {
+		if err := rabbitClient.Close(); err != nil {
+			logg.Error("failed to close rabbitmq connection", err)
+		}
+	}()
+	schedulerLogg := logg.Component(logger.ComponentScheduler)
+
+	checker := health.NewChecker()
+	logg.InfoWithParams("opening storage", map[string]string{"backend": backend.Name(cfg.DB)})
+	storage, err := backend.New(context.Background(), cfg.DB, logg.Component(logger.ComponentStorage))
 	if err != nil {
 		logg.Fatal("failed connect to db", err)
 	}
+	if c, ok := storage.(io.Closer); ok {
+		defer func() {
+			if err := c.Close(); err != nil {
+				logg.Error("failed to close storage", err)
+			}
+		}()
+	}
+	if p, ok := storage.(backend.Pinger); ok {
+		checker.Add(backend.Name(cfg.DB), p.Ping)
+	}
+	checker.Add("rabbitmq", rabbitClient.Ping)
+	probes := health.NewServer(cfg.Server, checker, logg)
+	probes.Handle("GET /metrics", promhttp.Handler())
+	probes.Start()
 
-	notificationScheduler := scheduler.NewNotificationScheduler(sql, rabbitClient, logg, cfg.Rabbit.QueueName)
-	err = s.CreateJobs(notificationScheduler.GetJobs())
-	if err != nil {
-		log.Fatal().Err(err).Msg("create jobs")
+	var elector scheduler.Elector
+	if cfg.Election.Enabled {
+		election := leader.New("calendar_scheduler", schedulerLogg)
+		go election.Run(ctx, storage, cfg.Election.Interval)
+		elector = election
 	}
+	s := scheduler.NewScheduler(schedulerLogg, elector, cfg.Admin.HistorySize)
 
-	ctx, cancel := signal.NotifyContext(context.Background(),
-		syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
-	defer cancel()
+	notificationScheduler := scheduler.NewNotificationScheduler(
+		storage, rabbitClient, schedulerLogg, cfg.Rabbit.QueueName, schedulerSettings(cfg),
+	)
+	notificationScheduler.Register(s)
+	if err := s.Apply(jobDefinitions(cfg.Jobs)); err != nil {
+		logg.Fatal("failed to create jobs", err)
+	}
+	var adminServer *admin.Server
+	if cfg.Admin.Enabled {
+		adminServer = admin.NewServer(config.HTTPServer{HTTPHost: cfg.Admin.HTTPHost, HTTPPort: cfg.Admin.HTTPPort}, s, logg)
+		adminServer.Start()
+	}
+
+	reloader := reload.New(cfg, func() (config.CalendarSchedulerConfig, error) {
+		return config.LoadSchedulerConfig(configFile)
+	}, func(next config.CalendarSchedulerConfig) error {
+		// The jobs are checked before anything is changed, so a refused reload leaves the old config in place.
+		definitions := jobDefinitions(next.Jobs)
+		if err := s.Validate(definitions); err != nil {
+			return err
+		}
+		if err := logger.Configure(next.Logger); err != nil {
+			return err
+		}
+		if err := s.Apply(definitions); err != nil {
+			return err
+		}
+		notificationScheduler.Apply(schedulerSettings(next))
+		return nil
+	}, logg, "logging", "jobs", "notifications", "retention")
+	go reloader.WatchSIGHUP(ctx)
 
 	go func() {
 		<-ctx.Done()
 		s.Shutdown()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		if err := probes.Stop(ctx); err != nil {
+			logg.Error("failed to stop probes server", err)
+		}
+		if adminServer != nil {
+			if err := adminServer.Stop(ctx); err != nil {
+				logg.Error("failed to stop admin server", err)
+			}
+		}
 	}()
 
 	s.Start(ctx)
 }
+
+func schedulerSettings(cfg config.CalendarSchedulerConfig) scheduler.Settings {
+	return scheduler.Settings{
+		GraceWindow:     cfg.Notifications.GraceWindow,
+		ClaimTimeout:    cfg.Notifications.ClaimTimeout,
+		Retention:       cfg.Retention.Period,
+		DeleteBatchSize: cfg.Retention.BatchSize,
+		DryRun:          cfg.Retention.DryRun,
+		ArchiveDir:      archiveDir(cfg.Retention.Archive),
+	}
+}
+
+func jobDefinitions(jobs []config.JobConf) []scheduler.JobDefinition {
+	definitions := make([]scheduler.JobDefinition, 0, len(jobs))
+	for _, j := range jobs {
+		definitions = append(definitions, scheduler.JobDefinition(j))
+	}
+	return definitions
+}
+
+func archiveDir(cfg config.ArchiveConf) string {
+	if !cfg.Enabled {
+		return ""
+	}
+	return cfg.Dir
+}
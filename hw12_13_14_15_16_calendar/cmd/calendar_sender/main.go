@@ -3,17 +3,23 @@ package main
 import (
 	"context"
 	"flag"
+	"io"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/google/uuid"
 	_ "github.com/jackc/pgx/stdlib"
-	"github.com/rs/zerolog"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/client"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/health"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/logger"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/reload"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/sender"
-	sqlstorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/sql"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/backend"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/tracing"
 )
 
 var configFile string
@@ -32,24 +38,111 @@ func main() {
 
 	cfg := config.NewSenderConfig(configFile)
 
-	level, err := zerolog.ParseLevel(cfg.Logger.Level)
-	if err != nil {
-		log.Fatal().Err(err).Msg("parsing logging level")
+	if err := logger.Configure(cfg.Logger); err != nil {
+		log.Fatal().Err(err).Msg("failed to configure logger")
 	}
-	zerolog.SetGlobalLevel(level)
 	logg := logger.New()
 
-	rabbitClient := client.NewRabbitClient(cfg.Rabbit.ConnectionString, logg)
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing, "calendar_sender")
+	if err != nil {
+		logg.Fatal("failed to init tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logg.Error("failed to flush traces", err)
+		}
+	}()
 
-	sql := sqlstorage.New(cfg.DB.CollectDsn(), cfg.DB)
-	err = sql.Connect(context.Background())
+	rabbitClient := client.NewRabbitClient(cfg.Rabbit, logg)
+	defer func() {
+		if err := rabbitClient.Close(); err != nil {
+			logg.Error("failed to close rabbitmq connection", err)
+		}
+	}()
+
+	checker := health.NewChecker()
+	logg.InfoWithParams("opening storage", map[string]string{"backend": backend.Name(cfg.DB)})
+	storage, err := backend.New(context.Background(), cfg.DB, logg.Component(logger.ComponentStorage))
 	if err != nil {
 		logg.Fatal("failed connect to db", err)
 	}
+	if c, ok := storage.(io.Closer); ok {
+		defer func() {
+			if err := c.Close(); err != nil {
+				logg.Error("failed to close storage", err)
+			}
+		}()
+	}
+	if p, ok := storage.(backend.Pinger); ok {
+		checker.Add(backend.Name(cfg.DB), p.Ping)
+	}
+	checker.Add("rabbitmq", rabbitClient.Ping)
+	probes := health.NewServer(cfg.Server, checker, logg)
+	probes.Handle("GET /metrics", promhttp.Handler())
+	probes.Start()
 
-	notificationSender := sender.NewNotificationSender(rabbitClient, cfg.Rabbit.QueueName, logg, sql)
-	ctx, cancel := signal.NotifyContext(context.Background(),
-		syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	senderLogg := logg.Component(logger.ComponentSender)
+	delivery, err := newDelivery(cfg.Delivery, senderLogg)
+	if err != nil {
+		logg.Fatal("failed to create delivery", err)
+	}
+	notificationSender := sender.NewNotificationSender(
+		rabbitClient, cfg.Rabbit.QueueName, senderLogg, storage, delivery, sender.Settings(cfg.Consumer),
+	)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
+
+	reloader := reload.New(cfg, func() (config.CalendarSenderConfig, error) {
+		return config.LoadSenderConfig(configFile)
+	}, func(next config.CalendarSenderConfig) error {
+		return logger.Configure(next.Logger)
+	}, logg, "logging")
+	go reloader.WatchSIGHUP(ctx)
+
+	go func() {
+		<-ctx.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		if err := probes.Stop(ctx); err != nil {
+			logg.Error("failed to stop probes server", err)
+		}
+	}()
+
 	notificationSender.StartListening(ctx)
 }
+
+func newDelivery(cfg config.DeliveryConf, lg sender.Logger) (*sender.Delivery, error) {
+	sources := make(map[string]map[string]sender.TemplateSource, len(cfg.Templates))
+	for channel, locales := range cfg.Templates {
+		sources[channel] = make(map[string]sender.TemplateSource, len(locales))
+		for locale, t := range locales {
+			sources[channel][locale] = sender.TemplateSource(t)
+		}
+	}
+	templates, err := sender.NewTemplates(sources, cfg.DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]sender.Recipient, len(cfg.Users))
+	for _, u := range cfg.Users {
+		// Ids are validated, the notifications carry them in the canonical form.
+		id := uuid.MustParse(u.ID).String()
+		users[id] = sender.Recipient{
+			UserID:     id,
+			Channel:    u.Channel,
+			Locale:     u.Locale,
+			Email:      u.Email,
+			WebhookURL: u.WebhookURL,
+		}
+	}
+	channels := map[string]sender.Channel{
+		config.ChannelLog:     sender.NewLogChannel(lg),
+		config.ChannelEmail:   sender.NewSMTPChannel(sender.SMTPSettings(cfg.SMTP)),
+		config.ChannelWebhook: sender.NewWebhookChannel(cfg.Webhook.Timeout),
+	}
+	preferences := sender.NewPreferences(cfg.DefaultChannel, cfg.DefaultLocale, users)
+	return sender.NewDelivery(preferences, templates, channels), nil
+}
@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.36.10
+// 	protoc-gen-go v1.36.11
 // 	protoc        v6.33.1
 // source: event/EventService.proto
 
@@ -14,6 +14,7 @@ import (
 	_ "google.golang.org/genproto/googleapis/api/annotations"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	fieldmaskpb "google.golang.org/protobuf/types/known/fieldmaskpb"
 	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -124,8 +125,11 @@ type UpdateEventRequest struct {
 	EventDuration    *int64                 `protobuf:"varint,4,opt,name=eventDuration,proto3,oneof" json:"eventDuration,omitempty"`
 	Description      *string                `protobuf:"bytes,5,opt,name=description,proto3,oneof" json:"description,omitempty"`
 	NotificationTime *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=notificationTime,proto3,oneof" json:"notificationTime,omitempty"`
-	unknownFields    protoimpl.UnknownFields
-	sizeCache        protoimpl.SizeCache
+	// Fields listed in the mask are overwritten with the request values, unset nullable
+	// fields (description, notificationTime) are cleared. Without a mask only set fields are applied.
+	UpdateMask    *fieldmaskpb.FieldMask `protobuf:"bytes,7,opt,name=updateMask,proto3" json:"updateMask,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *UpdateEventRequest) Reset() {
@@ -200,6 +204,13 @@ func (x *UpdateEventRequest) GetNotificationTime() *timestamppb.Timestamp {
 	return nil
 }
 
+func (x *UpdateEventRequest) GetUpdateMask() *fieldmaskpb.FieldMask {
+	if x != nil {
+		return x.UpdateMask
+	}
+	return nil
+}
+
 type CreateEventRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Event         *Event                 `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
@@ -496,7 +507,7 @@ var File_event_EventService_proto protoreflect.FileDescriptor
 
 const file_event_EventService_proto_rawDesc = "" +
 	"\n" +
-	"\x18event/EventService.proto\x12\x05event\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1cgoogle/api/annotations.proto\"\xa7\x02\n" +
+	"\x18event/EventService.proto\x12\x05event\x1a\x1fgoogle/protobuf/timestamp.proto\x1a google/protobuf/field_mask.proto\x1a\x1cgoogle/api/annotations.proto\"\xa7\x02\n" +
 	"\x05Event\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
 	"\x05title\x18\x02 \x01(\tR\x05title\x126\n" +
@@ -505,14 +516,17 @@ const file_event_EventService_proto_rawDesc = "" +
 	"\vdescription\x18\x05 \x01(\tR\vdescription\x12\x16\n" +
 	"\x06userId\x18\x06 \x01(\tR\x06userId\x12K\n" +
 	"\x10notificationTime\x18\a \x01(\v2\x1a.google.protobuf.TimestampH\x00R\x10notificationTime\x88\x01\x01B\x13\n" +
-	"\x11_notificationTime\"\xe9\x02\n" +
+	"\x11_notificationTime\"\xa5\x03\n" +
 	"\x12UpdateEventRequest\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x19\n" +
 	"\x05title\x18\x02 \x01(\tH\x00R\x05title\x88\x01\x01\x12;\n" +
 	"\bdateTime\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampH\x01R\bdateTime\x88\x01\x01\x12)\n" +
 	"\reventDuration\x18\x04 \x01(\x03H\x02R\reventDuration\x88\x01\x01\x12%\n" +
 	"\vdescription\x18\x05 \x01(\tH\x03R\vdescription\x88\x01\x01\x12K\n" +
-	"\x10notificationTime\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampH\x04R\x10notificationTime\x88\x01\x01B\b\n" +
+	"\x10notificationTime\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampH\x04R\x10notificationTime\x88\x01\x01\x12:\n" +
+	"\n" +
+	"updateMask\x18\a \x01(\v2\x1a.google.protobuf.FieldMaskR\n" +
+	"updateMaskB\b\n" +
 	"\x06_titleB\v\n" +
 	"\t_dateTimeB\x10\n" +
 	"\x0e_eventDurationB\x0e\n" +
@@ -561,30 +575,32 @@ var file_event_EventService_proto_goTypes = []any{
 	(*EventsResponse)(nil),        // 7: event.EventsResponse
 	(*EventResponse)(nil),         // 8: event.EventResponse
 	(*timestamppb.Timestamp)(nil), // 9: google.protobuf.Timestamp
+	(*fieldmaskpb.FieldMask)(nil), // 10: google.protobuf.FieldMask
 }
 var file_event_EventService_proto_depIdxs = []int32{
 	9,  // 0: event.Event.dateTime:type_name -> google.protobuf.Timestamp
 	9,  // 1: event.Event.notificationTime:type_name -> google.protobuf.Timestamp
 	9,  // 2: event.UpdateEventRequest.dateTime:type_name -> google.protobuf.Timestamp
 	9,  // 3: event.UpdateEventRequest.notificationTime:type_name -> google.protobuf.Timestamp
-	0,  // 4: event.CreateEventRequest.event:type_name -> event.Event
-	0,  // 5: event.EventsResponse.events:type_name -> event.Event
-	0,  // 6: event.EventResponse.event:type_name -> event.Event
-	2,  // 7: event.EventService.CreateEvent:input_type -> event.CreateEventRequest
-	5,  // 8: event.EventService.GetEventsByUserID:input_type -> event.GetByUserIdRequest
-	6,  // 9: event.EventService.GetById:input_type -> event.ByIdRequest
-	1,  // 10: event.EventService.UpdateEvent:input_type -> event.UpdateEventRequest
-	6,  // 11: event.EventService.DeleteEvent:input_type -> event.ByIdRequest
-	3,  // 12: event.EventService.CreateEvent:output_type -> event.CreateEventResponse
-	7,  // 13: event.EventService.GetEventsByUserID:output_type -> event.EventsResponse
-	8,  // 14: event.EventService.GetById:output_type -> event.EventResponse
-	8,  // 15: event.EventService.UpdateEvent:output_type -> event.EventResponse
-	4,  // 16: event.EventService.DeleteEvent:output_type -> event.DeleteEventResponse
-	12, // [12:17] is the sub-list for method output_type
-	7,  // [7:12] is the sub-list for method input_type
-	7,  // [7:7] is the sub-list for extension type_name
-	7,  // [7:7] is the sub-list for extension extendee
-	0,  // [0:7] is the sub-list for field type_name
+	10, // 4: event.UpdateEventRequest.updateMask:type_name -> google.protobuf.FieldMask
+	0,  // 5: event.CreateEventRequest.event:type_name -> event.Event
+	0,  // 6: event.EventsResponse.events:type_name -> event.Event
+	0,  // 7: event.EventResponse.event:type_name -> event.Event
+	2,  // 8: event.EventService.CreateEvent:input_type -> event.CreateEventRequest
+	5,  // 9: event.EventService.GetEventsByUserID:input_type -> event.GetByUserIdRequest
+	6,  // 10: event.EventService.GetById:input_type -> event.ByIdRequest
+	1,  // 11: event.EventService.UpdateEvent:input_type -> event.UpdateEventRequest
+	6,  // 12: event.EventService.DeleteEvent:input_type -> event.ByIdRequest
+	3,  // 13: event.EventService.CreateEvent:output_type -> event.CreateEventResponse
+	7,  // 14: event.EventService.GetEventsByUserID:output_type -> event.EventsResponse
+	8,  // 15: event.EventService.GetById:output_type -> event.EventResponse
+	8,  // 16: event.EventService.UpdateEvent:output_type -> event.EventResponse
+	4,  // 17: event.EventService.DeleteEvent:output_type -> event.DeleteEventResponse
+	13, // [13:18] is the sub-list for method output_type
+	8,  // [8:13] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
 }
 
 func init() { file_event_EventService_proto_init() }
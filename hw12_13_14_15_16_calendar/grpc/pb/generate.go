@@ -1,3 +1,3 @@
 package pb
 
-//go:generate protoc -I=../../api --go_out=. --go-grpc_out=. --grpc-gateway_out=. ../../api/event/EventService.proto
+//go:generate protoc -I=../../api --go_out=. --go-grpc_out=. --grpc-gateway_out=. --openapiv2_out=. ../../api/event/EventService.proto
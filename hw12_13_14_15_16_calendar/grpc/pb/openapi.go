@@ -0,0 +1,8 @@
+package pb
+
+import _ "embed"
+
+// OpenAPISpec is the OpenAPI v2 document generated from api/event/EventService.proto.
+//
+//go:embed event/EventService.swagger.json
+var OpenAPISpec []byte
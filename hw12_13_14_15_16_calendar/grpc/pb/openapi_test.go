@@ -0,0 +1,121 @@
+package pb
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type openAPIDocument struct {
+	Paths       map[string]map[string]openAPIOperation `json:"paths"`
+	Definitions map[string]openAPIDefinition           `json:"definitions"`
+}
+
+type openAPIOperation struct {
+	OperationID string `json:"operationId"`
+}
+
+type openAPIDefinition struct {
+	Properties map[string]json.RawMessage `json:"properties"`
+}
+
+// TestOpenAPISpecIsUpToDate regenerates the spec from api/event/EventService.proto and fails
+// when the embedded one differs, run `make generate` to fix it. It is skipped without protoc.
+func TestOpenAPISpecIsUpToDate(t *testing.T) {
+	for _, tool := range []string{"protoc", "protoc-gen-openapiv2"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+	dir := t.TempDir()
+	out, err := exec.Command(
+		"protoc", "-I=../../api", "--openapiv2_out="+dir, "../../api/event/EventService.proto",
+	).CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	generated, err := os.ReadFile(filepath.Join(dir, "event", "EventService.swagger.json"))
+	require.NoError(t, err)
+	require.Equal(t, string(generated), string(OpenAPISpec), "the embedded spec is stale, run `make generate`")
+}
+
+// TestOpenAPISpecMatchesDescriptors checks the paths and the properties of the spec against
+// the compiled descriptors, it runs where protoc is not installed.
+func TestOpenAPISpecMatchesDescriptors(t *testing.T) {
+	var doc openAPIDocument
+	require.NoError(t, json.Unmarshal(OpenAPISpec, &doc))
+
+	file := File_event_EventService_proto
+	service := file.Services().ByName("EventService")
+	require.NotNil(t, service)
+
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		rule, ok := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+		require.True(t, ok, "method %s has no http rule", method.Name())
+
+		verb, path := httpRulePattern(rule)
+		operation, ok := doc.Paths[path][verb]
+		require.True(t, ok, "spec has no %s %s for %s", verb, path, method.Name())
+		require.Equal(t, "EventService_"+string(method.Name()), operation.OperationID)
+
+		requireDefinition(t, doc, method.Output())
+		if rule.GetBody() == "*" {
+			requireDefinition(t, doc, method.Input())
+		}
+	}
+
+	messages := file.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		message := messages.Get(i)
+		if _, ok := doc.Definitions[definitionName(message)]; ok {
+			requireDefinition(t, doc, message)
+		}
+	}
+}
+
+func requireDefinition(t *testing.T, doc openAPIDocument, message protoreflect.MessageDescriptor) {
+	t.Helper()
+	definition, ok := doc.Definitions[definitionName(message)]
+	require.True(t, ok, "spec has no definition for %s", message.FullName())
+
+	fields := message.Fields()
+	expected := make([]string, 0, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		expected = append(expected, fields.Get(i).JSONName())
+	}
+	actual := make([]string, 0, len(definition.Properties))
+	for name := range definition.Properties {
+		actual = append(actual, name)
+	}
+	require.ElementsMatch(t, expected, actual, "definition of %s differs from proto", message.FullName())
+}
+
+func definitionName(message protoreflect.MessageDescriptor) string {
+	return strings.ReplaceAll(string(message.FullName()), ".", "")
+}
+
+func httpRulePattern(rule *annotations.HttpRule) (string, string) {
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return "get", pattern.Get
+	case *annotations.HttpRule_Post:
+		return "post", pattern.Post
+	case *annotations.HttpRule_Put:
+		return "put", pattern.Put
+	case *annotations.HttpRule_Patch:
+		return "patch", pattern.Patch
+	case *annotations.HttpRule_Delete:
+		return "delete", pattern.Delete
+	default:
+		return "", ""
+	}
+}
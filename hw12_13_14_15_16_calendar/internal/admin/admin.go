@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/scheduler"
+)
+
+// Scheduler is the part of the scheduler exposed to operators.
+type Scheduler interface {
+	Leader(ctx context.Context) bool
+	Jobs() []scheduler.JobStatus
+	Job(name string) (scheduler.JobStatus, error)
+	History(job string) []scheduler.Run
+	Trigger(ctx context.Context, name string) error
+	Pause(name string) error
+	Resume(name string) error
+}
+
+// jobList tells whether the replica leads, only the leader runs and triggers the jobs.
+type jobList struct {
+	Leader bool                  `json:"leader"`
+	Jobs   []scheduler.JobStatus `json:"jobs"`
+}
+
+type jobDetails struct {
+	scheduler.JobStatus
+	History []scheduler.Run `json:"history"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Register adds the job routes to mux:
+// GET /jobs, GET /jobs/{name}, GET /runs?job=, POST /jobs/{name}/trigger, /pause and /resume.
+func Register(mux *http.ServeMux, s Scheduler) {
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, jobList{Leader: s.Leader(r.Context()), Jobs: s.Jobs()})
+	})
+	mux.HandleFunc("GET /jobs/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		status, err := s.Job(name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, jobDetails{JobStatus: status, History: s.History(name)})
+	})
+	mux.HandleFunc("GET /runs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.History(r.URL.Query().Get("job")))
+	})
+	mux.HandleFunc("POST /jobs/{name}/trigger", action(s, s.Trigger, http.StatusAccepted))
+	mux.HandleFunc("POST /jobs/{name}/pause", action(s, withoutContext(s.Pause), http.StatusOK))
+	mux.HandleFunc("POST /jobs/{name}/resume", action(s, withoutContext(s.Resume), http.StatusOK))
+}
+
+// action calls fn with the job name and responds with the job status.
+func action(s Scheduler, fn func(ctx context.Context, name string) error, code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if err := fn(r.Context(), name); err != nil {
+			writeError(w, err)
+			return
+		}
+		status, err := s.Job(name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, code, status)
+	}
+}
+
+func withoutContext(fn func(name string) error) func(context.Context, string) error {
+	return func(_ context.Context, name string) error { return fn(name) }
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		code = http.StatusNotFound
+	case errors.Is(err, scheduler.ErrJobPaused), errors.Is(err, scheduler.ErrJobNotScheduled),
+		errors.Is(err, scheduler.ErrNotLeader), errors.Is(err, scheduler.ErrNotStarted):
+		code = http.StatusConflict
+	}
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
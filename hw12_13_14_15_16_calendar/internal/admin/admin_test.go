@@ -0,0 +1,120 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/scheduler"
+)
+
+type testLogger struct{}
+
+func (testLogger) InfoWithParams(string, map[string]string) {}
+
+func (testLogger) Error(string, error) {}
+
+func (testLogger) Info(string) {}
+
+// start runs s until the test ends.
+func start(t *testing.T, s *scheduler.CalendarScheduler) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		s.Shutdown()
+	})
+}
+
+func TestRegister(t *testing.T) {
+	s := scheduler.NewScheduler(testLogger{}, nil, 10)
+	start(t, s)
+	ran := make(chan struct{}, 1)
+	s.Register("send_events", func(context.Context) error {
+		ran <- struct{}{}
+		return nil
+	})
+	require.NoError(t, s.Apply([]scheduler.JobDefinition{{Name: "send_events", Enabled: true, Cron: "0 0 1 1 *"}}))
+
+	mux := http.NewServeMux()
+	Register(mux, s)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/jobs")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `{"leader":true,"jobs":[{"name":"send_events","schedule":"0 0 1 1 *"`)
+
+	require.Equal(t, http.StatusNotFound, do(http.MethodGet, "/jobs/unknown").Code)
+	require.Equal(t, http.StatusNotFound, do(http.MethodPost, "/jobs/unknown/trigger").Code)
+
+	// The job is triggered once the scheduler is started, before that the request is refused.
+	require.Eventually(t, func() bool {
+		return do(http.MethodPost, "/jobs/send_events/trigger").Code == http.StatusAccepted
+	}, time.Second, time.Millisecond)
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("triggered job did not run")
+	}
+	require.Eventually(t, func() bool { return len(s.History("send_events")) == 1 }, time.Second, time.Millisecond)
+
+	rec = do(http.MethodGet, "/runs?job=send_events")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"job":"send_events"`)
+
+	rec = do(http.MethodPost, "/jobs/send_events/pause")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"paused":true`)
+	rec = do(http.MethodPost, "/jobs/send_events/trigger")
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.JSONEq(t, `{"error":"job is paused: send_events"}`, rec.Body.String())
+
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/jobs/send_events/resume").Code)
+	rec = do(http.MethodGet, "/jobs/send_events")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"paused":false`)
+	require.Contains(t, rec.Body.String(), `"history":[{"job":"send_events"`)
+}
+
+type followerElector struct{}
+
+func (followerElector) IsLeader(context.Context) error {
+	return errors.New("not leading")
+}
+
+func TestTriggerNotLeader(t *testing.T) {
+	s := scheduler.NewScheduler(testLogger{}, followerElector{}, 10)
+	start(t, s)
+	s.Register("send_events", func(context.Context) error { return nil })
+	require.NoError(t, s.Apply([]scheduler.JobDefinition{{Name: "send_events", Enabled: true, Cron: "0 0 1 1 *"}}))
+
+	mux := http.NewServeMux()
+	Register(mux, s)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	require.Contains(t, rec.Body.String(), `{"leader":false,`)
+
+	require.Eventually(t, func() bool {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jobs/send_events/trigger", nil))
+		return !strings.Contains(rec.Body.String(), scheduler.ErrNotStarted.Error())
+	}, time.Second, time.Millisecond)
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.JSONEq(t, `{"error":"replica is not the leader: not leading"}`, rec.Body.String())
+}
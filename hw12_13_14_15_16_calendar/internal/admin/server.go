@@ -0,0 +1,48 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+)
+
+type Logger interface {
+	Info(msg string)
+	Fatal(msg string, err error)
+}
+
+// Server serves the admin API of the scheduler, it has no authentication and should listen on a private address.
+type Server struct {
+	server *http.Server
+	lg     Logger
+}
+
+func NewServer(cfg config.HTTPServer, s Scheduler, lg Logger) *Server {
+	mux := http.NewServeMux()
+	Register(mux, s)
+	return &Server{
+		server: &http.Server{
+			Addr:              fmt.Sprintf("%s:%d", cfg.HTTPHost, cfg.HTTPPort),
+			Handler:           mux,
+			ReadHeaderTimeout: time.Second * 10,
+		},
+		lg: lg,
+	}
+}
+
+func (s *Server) Start() {
+	go func() {
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.lg.Fatal("failed to listen http "+s.server.Addr, err)
+		}
+	}()
+	s.lg.Info("scheduler admin api is served on " + s.server.Addr)
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,68 @@
+package cache
+
+// list is the doubly linked list of hw04_lru_cache, the front holds the most recently used item.
+type list[V any] struct {
+	length int
+	front  *listItem[V]
+	back   *listItem[V]
+}
+
+type listItem[V any] struct {
+	Value V
+	next  *listItem[V]
+	prev  *listItem[V]
+}
+
+func (l *list[V]) Len() int {
+	return l.length
+}
+
+func (l *list[V]) Back() *listItem[V] {
+	return l.back
+}
+
+func (l *list[V]) PushFront(v V) *listItem[V] {
+	item := &listItem[V]{
+		Value: v,
+		next:  l.front,
+	}
+	if l.front != nil {
+		l.front.prev = item
+	} else {
+		l.back = item
+	}
+	l.front = item
+	l.length++
+	return item
+}
+
+func (l *list[V]) Remove(i *listItem[V]) {
+	if i.prev != nil {
+		i.prev.next = i.next
+	} else {
+		l.front = i.next
+	}
+	if i.next != nil {
+		i.next.prev = i.prev
+	} else {
+		l.back = i.prev
+	}
+	i.next, i.prev = nil, nil
+	l.length--
+}
+
+func (l *list[V]) MoveToFront(i *listItem[V]) {
+	if i.prev == nil {
+		return
+	}
+	i.prev.next = i.next
+	if i.next != nil {
+		i.next.prev = i.prev
+	} else {
+		l.back = i.prev
+	}
+	i.next = l.front
+	i.prev = nil
+	l.front.prev = i
+	l.front = i
+}
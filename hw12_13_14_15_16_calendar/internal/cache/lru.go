@@ -0,0 +1,120 @@
+// Package cache is the LRU cache of hw04_lru_cache with expiring entries, safe for concurrent use.
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type LRU[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	queue    list[entry[K, V]]
+	items    map[K]*listItem[entry[K, V]]
+	now      func() time.Time
+	// generation changes with every Remove and Clear.
+	generation uint64
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// New returns a cache of at most capacity entries, an entry expires ttl after it was set.
+func New[K comparable, V any](capacity int, ttl time.Duration) *LRU[K, V] {
+	return &LRU[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[K]*listItem[entry[K, V]], capacity),
+		now:      time.Now,
+	}
+}
+
+// Set stores the value, evicting the least recently used entry when the cache is full.
+// It reports whether the key was already cached.
+func (l *LRU[K, V]) Set(key K, value V) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.set(key, value)
+}
+
+// Generation returns a value that changes when an entry is removed or the cache is cleared.
+func (l *LRU[K, V]) Generation() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.generation
+}
+
+// SetIfUnchanged stores the value like Set unless something was removed since Generation returned
+// generation, so a value read before an invalidation is not stored after it. It reports whether it stored.
+func (l *LRU[K, V]) SetIfUnchanged(key K, value V, generation uint64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.generation != generation {
+		return false
+	}
+	l.set(key, value)
+	return true
+}
+
+func (l *LRU[K, V]) set(key K, value V) bool {
+	e := entry[K, V]{key: key, value: value, expires: l.now().Add(l.ttl)}
+	if item, ok := l.items[key]; ok {
+		item.Value = e
+		l.queue.MoveToFront(item)
+		return true
+	}
+	if l.queue.Len() == l.capacity {
+		back := l.queue.Back()
+		l.queue.Remove(back)
+		delete(l.items, back.Value.key)
+	}
+	l.items[key] = l.queue.PushFront(e)
+	return false
+}
+
+// Get returns the value unless it is missing or expired.
+func (l *LRU[K, V]) Get(key K) (V, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	item, ok := l.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	if !l.now().Before(item.Value.expires) {
+		l.queue.Remove(item)
+		delete(l.items, key)
+		var zero V
+		return zero, false
+	}
+	l.queue.MoveToFront(item)
+	return item.Value.value, true
+}
+
+func (l *LRU[K, V]) Remove(key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.generation++
+	if item, ok := l.items[key]; ok {
+		l.queue.Remove(item)
+		delete(l.items, key)
+	}
+}
+
+func (l *LRU[K, V]) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.generation++
+	l.queue = list[entry[K, V]]{}
+	l.items = make(map[K]*listItem[entry[K, V]], l.capacity)
+}
+
+func (l *LRU[K, V]) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.queue.Len()
+}
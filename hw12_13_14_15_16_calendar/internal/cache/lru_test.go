@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	t.Run("simple", func(t *testing.T) {
+		c := New[string, int](5, time.Minute)
+
+		require.False(t, c.Set("aaa", 100))
+		require.False(t, c.Set("bbb", 200))
+
+		val, ok := c.Get("aaa")
+		require.True(t, ok)
+		require.Equal(t, 100, val)
+
+		require.True(t, c.Set("aaa", 300))
+		val, ok = c.Get("aaa")
+		require.True(t, ok)
+		require.Equal(t, 300, val)
+
+		_, ok = c.Get("ccc")
+		require.False(t, ok)
+	})
+
+	t.Run("evicts the least recently used", func(t *testing.T) {
+		c := New[string, int](2, time.Minute)
+		c.Set("one", 1)
+		c.Set("two", 2)
+		c.Get("one")
+		c.Set("three", 3)
+
+		_, ok := c.Get("two")
+		require.False(t, ok)
+		_, ok = c.Get("one")
+		require.True(t, ok)
+		_, ok = c.Get("three")
+		require.True(t, ok)
+		require.Equal(t, 2, c.Len())
+	})
+
+	t.Run("expires", func(t *testing.T) {
+		now := time.Now()
+		c := New[string, int](2, time.Minute)
+		c.now = func() time.Time { return now }
+		c.Set("one", 1)
+
+		now = now.Add(59 * time.Second)
+		_, ok := c.Get("one")
+		require.True(t, ok)
+
+		now = now.Add(time.Second)
+		_, ok = c.Get("one")
+		require.False(t, ok)
+		require.Equal(t, 0, c.Len())
+	})
+
+	t.Run("remove and clear", func(t *testing.T) {
+		c := New[string, int](3, time.Minute)
+		c.Set("one", 1)
+		c.Set("two", 2)
+		c.Set("three", 3)
+
+		c.Remove("two")
+		_, ok := c.Get("two")
+		require.False(t, ok)
+		require.Equal(t, 2, c.Len())
+
+		c.Clear()
+		_, ok = c.Get("one")
+		require.False(t, ok)
+		require.Equal(t, 0, c.Len())
+	})
+
+	t.Run("set if unchanged", func(t *testing.T) {
+		c := New[string, int](3, time.Minute)
+		generation := c.Generation()
+		require.True(t, c.SetIfUnchanged("one", 1, generation))
+
+		c.Remove("two")
+		require.False(t, c.SetIfUnchanged("one", 2, generation), "a removal in between refuses the value")
+		v, ok := c.Get("one")
+		require.True(t, ok)
+		require.Equal(t, 1, v)
+
+		generation = c.Generation()
+		c.Clear()
+		require.False(t, c.SetIfUnchanged("one", 3, generation))
+		require.Equal(t, 0, c.Len())
+	})
+}
+
+func TestLRUConcurrent(t *testing.T) {
+	c := New[string, int](10, time.Minute)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(i % 20)
+				c.Set(key, i)
+				c.Get(key)
+				if i%7 == 0 {
+					c.Remove(key)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.LessOrEqual(t, c.Len(), 10)
+}
@@ -0,0 +1,85 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNoServerCertificate = errors.New("server certificate is not configured")
+	ErrNoPeerCertificate   = errors.New("peer did not present a certificate")
+)
+
+// ServerConfig serves the certificate of r and, when r has a CA file, requires clients
+// to present a certificate signed by it (mutual TLS).
+// Certificates are taken from r on every handshake, so reloaded files are picked up without restart.
+func ServerConfig(r *Reloader) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert := r.Certificate()
+			if cert == nil {
+				return nil, ErrNoServerCertificate
+			}
+			return cert, nil
+		},
+	}
+	if r.caFile != "" {
+		cfg.ClientAuth = tls.RequireAnyClientCert
+		cfg.VerifyPeerCertificate = verifyPeer(r, "", x509.ExtKeyUsageClientAuth)
+	}
+	return cfg
+}
+
+// ClientConfig verifies the server against the CA of r, or the system pool when r has no CA file,
+// and presents the certificate of r when the server asks for one.
+func ClientConfig(r *Reloader, serverName string) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := r.Certificate(); cert != nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+	if r.caFile != "" {
+		// The chain is verified in VerifyPeerCertificate against the current CA pool,
+		// the default verification would keep the pool the config was created with.
+		cfg.InsecureSkipVerify = true //nolint:gosec
+		cfg.VerifyPeerCertificate = verifyPeer(r, serverName, x509.ExtKeyUsageServerAuth)
+	}
+	return cfg
+}
+
+func verifyPeer(
+	r *Reloader, dnsName string, usage x509.ExtKeyUsage,
+) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return ErrNoPeerCertificate
+		}
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("parse peer certificate : %w", err)
+			}
+			certs = append(certs, cert)
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         r.CAPool(),
+			Intermediates: intermediates,
+			DNSName:       dnsName,
+			KeyUsages:     []x509.ExtKeyUsage{usage},
+		})
+		return err
+	}
+}
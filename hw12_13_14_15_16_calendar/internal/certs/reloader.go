@@ -0,0 +1,126 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrNoCertificates = errors.New("no certificates found in CA file")
+
+// Reloader keeps a key pair and a CA pool loaded from files and reloads them when the files change.
+// Any of the files may be empty, then the corresponding part is not served.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	caPool  *x509.CertPool
+	modTime map[string]time.Time
+}
+
+func NewReloader(certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		modTime:  make(map[string]time.Time),
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again if any of them was modified since the last load
+// and reports whether anything was reloaded. On error the previous certificates stay in use.
+func (r *Reloader) Reload() (bool, error) {
+	modTime, changed, err := r.stat()
+	if err != nil || !changed {
+		return false, err
+	}
+
+	var cert *tls.Certificate
+	if r.certFile != "" || r.keyFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return false, fmt.Errorf("load key pair : %w", err)
+		}
+		cert = &pair
+	}
+	var caPool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return false, fmt.Errorf("read CA file : %w", err)
+		}
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("%w: %s", ErrNoCertificates, r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = cert
+	r.caPool = caPool
+	r.modTime = modTime
+	return true, nil
+}
+
+// Watch polls the files every interval until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, onReload func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if reloaded || err != nil {
+				onReload(err)
+			}
+		}
+	}
+}
+
+func (r *Reloader) stat() (map[string]time.Time, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	modTime := make(map[string]time.Time, len(r.modTime))
+	changed := false
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, false, fmt.Errorf("stat %s : %w", file, err)
+		}
+		modTime[file] = info.ModTime()
+		if last, ok := r.modTime[file]; !ok || !last.Equal(info.ModTime()) {
+			changed = true
+		}
+	}
+	return modTime, changed, nil
+}
+
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+func (r *Reloader) CAPool() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.caPool
+}
@@ -0,0 +1,185 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(t *testing.T) authority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return authority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a certificate for localhost signed by ca and returns paths to it and its key.
+func (ca authority) issue(t *testing.T, dir, name string, serial int64) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile
+}
+
+func handshake(t *testing.T, server, client *tls.Config) (*x509.Certificate, error) {
+	t.Helper()
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	require.NoError(t, err)
+	defer lis.Close()
+
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Read completes the server side of the handshake and waits for the client to hang up.
+		_, _ = conn.Read(make([]byte, 1))
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), client)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// In TLS 1.3 the server checks the client certificate after the client finished its handshake,
+	// the rejection arrives on the first read.
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err = conn.Read(make([]byte, 1)); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil, err
+	}
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newAuthority(t)
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0o600))
+
+	serverCert, serverKey := ca.issue(t, dir, "server", 2)
+	clientCert, clientKey := ca.issue(t, dir, "client", 3)
+
+	server, err := NewReloader(serverCert, serverKey, caFile)
+	require.NoError(t, err)
+
+	t.Run("client with certificate", func(t *testing.T) {
+		client, err := NewReloader(clientCert, clientKey, caFile)
+		require.NoError(t, err)
+		peer, err := handshake(t, ServerConfig(server), ClientConfig(client, "localhost"))
+		require.NoError(t, err)
+		require.Equal(t, "server", peer.Subject.CommonName)
+	})
+
+	t.Run("client without certificate", func(t *testing.T) {
+		client, err := NewReloader("", "", caFile)
+		require.NoError(t, err)
+		_, err = handshake(t, ServerConfig(server), ClientConfig(client, "localhost"))
+		require.Error(t, err)
+	})
+
+	t.Run("wrong server name", func(t *testing.T) {
+		client, err := NewReloader(clientCert, clientKey, caFile)
+		require.NoError(t, err)
+		_, err = handshake(t, ServerConfig(server), ClientConfig(client, "calendar.example"))
+		require.Error(t, err)
+	})
+
+	t.Run("certificate signed by another CA", func(t *testing.T) {
+		otherCert, otherKey := newAuthority(t).issue(t, t.TempDir(), "other", 4)
+		client, err := NewReloader(otherCert, otherKey, caFile)
+		require.NoError(t, err)
+		_, err = handshake(t, ServerConfig(server), ClientConfig(client, "localhost"))
+		require.Error(t, err)
+	})
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newAuthority(t)
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0o600))
+	certFile, keyFile := ca.issue(t, dir, "server", 2)
+
+	server, err := NewReloader(certFile, keyFile, "")
+	require.NoError(t, err)
+	client, err := NewReloader("", "", caFile)
+	require.NoError(t, err)
+
+	reloaded, err := server.Reload()
+	require.NoError(t, err)
+	require.False(t, reloaded)
+
+	ca.issue(t, dir, "server", 5)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	require.NoError(t, os.Chtimes(keyFile, future, future))
+
+	reloaded, err = server.Reload()
+	require.NoError(t, err)
+	require.True(t, reloaded)
+
+	peer, err := handshake(t, ServerConfig(server), ClientConfig(client, "localhost"))
+	require.NoError(t, err)
+	require.Equal(t, int64(5), peer.SerialNumber.Int64())
+
+	t.Run("broken files keep previous certificate", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0o600))
+		future = future.Add(time.Minute)
+		require.NoError(t, os.Chtimes(keyFile, future, future))
+
+		_, err := server.Reload()
+		require.Error(t, err)
+		peer, err := handshake(t, ServerConfig(server), ClientConfig(client, "localhost"))
+		require.NoError(t, err)
+		require.Equal(t, int64(5), peer.SerialNumber.Int64())
+	})
+}
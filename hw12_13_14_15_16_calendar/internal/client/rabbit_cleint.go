@@ -2,79 +2,258 @@ package client
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/rs/zerolog/log"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/certs"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/requestid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	ErrConnectionClosed = errors.New("rabbitmq connection is closed")
+	ErrNotConfirmed     = errors.New("rabbitmq did not confirm the message")
+)
+
+// Delays between the attempts to dial a lost connection again.
+const (
+	minRedialDelay = time.Second
+	maxRedialDelay = 30 * time.Second
 )
 
 type RabbitLogger interface {
+	InfoWithParams(msg string, params map[string]string)
 	ErrorWithParams(msg string, params map[string]string, err error)
 }
 
 type RabbitClient struct {
 	connectionString string
-	connection       *amqp.Connection
+	tlsConf          config.ClientTLS
+	certs            *certs.Reloader
 	logger           RabbitLogger
+
+	mu         sync.Mutex
+	connection *amqp.Connection
+	closed     bool
+	done       chan struct{}
 }
 
-func NewRabbitClient(connectionString string, logger RabbitLogger) *RabbitClient {
+// NewRabbitClient connects to RabbitMQ, amqps:// connection strings are dialed over TLS
+// with the certificates from cfg.TLS. A lost connection is dialed again until Close.
+func NewRabbitClient(cfg config.Rabbit, logger RabbitLogger) *RabbitClient {
 	client := &RabbitClient{
-		connectionString: connectionString,
+		connectionString: cfg.ConnectionString,
+		tlsConf:          cfg.TLS,
 		logger:           logger,
+		done:             make(chan struct{}),
 	}
-	conn, err := amqp.Dial(connectionString)
+	conn, err := client.dial()
 	if err != nil {
 		log.Fatal().Err(err).Msg("create connect to RabbitMQ")
 	}
 	client.connection = conn
+	go client.reconnect(conn)
 	return client
 }
 
-func (c *RabbitClient) Send(queueName string, message []byte) error {
-	ch, err := c.connection.Channel()
+// Close stops dialing again and closes the connection.
+func (c *RabbitClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	if err := c.connection.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// reconnect waits for conn to close and replaces it with a new connection, the channels
+// of the old connection are closed and their users open new ones.
+func (c *RabbitClient) reconnect(conn *amqp.Connection) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case amqpErr, ok := <-conn.NotifyClose(make(chan *amqp.Error, 1)):
+			if ok {
+				c.logger.ErrorWithParams("rabbitmq connection is lost", nil, amqpErr)
+			}
+		}
+		conn = c.redial()
+		if conn == nil {
+			return
+		}
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		c.connection = conn
+		c.mu.Unlock()
+		c.logger.InfoWithParams("reconnected to rabbitmq", nil)
+	}
+}
+
+// redial dials until it succeeds, doubling the delay between the attempts. It returns nil after Close.
+func (c *RabbitClient) redial() *amqp.Connection {
+	delay := minRedialDelay
+	for {
+		t := time.NewTimer(delay)
+		select {
+		case <-c.done:
+			t.Stop()
+			return nil
+		case <-t.C:
+		}
+		conn, err := c.dial()
+		if err == nil {
+			return conn
+		}
+		delay = min(2*delay, maxRedialDelay)
+		c.logger.ErrorWithParams("dial rabbitmq", map[string]string{"retryIn": delay.String()}, err)
+	}
+}
+
+// current returns the latest connection, it is closed while the client reconnects.
+func (c *RabbitClient) current() *amqp.Connection {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connection
+}
+
+func (c *RabbitClient) dial() (*amqp.Connection, error) {
+	uri, err := amqp.ParseURI(c.connectionString)
+	if err != nil {
+		return nil, err
+	}
+	if uri.Scheme != "amqps" {
+		return amqp.Dial(c.connectionString)
+	}
+	// Certificates are read again on every dial, so rotated files are used from the next reconnect.
+	// An open connection keeps the certificates of its handshake.
+	if c.certs == nil {
+		c.certs, err = certs.NewReloader(c.tlsConf.CertFile, c.tlsConf.KeyFile, c.tlsConf.CAFile)
+	} else {
+		_, err = c.certs.Reload()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load rabbitmq certificates : %w", err)
+	}
+	serverName := c.tlsConf.ServerName
+	if serverName == "" {
+		serverName = uri.Host
+	}
+	return amqp.DialTLS(c.connectionString, certs.ClientConfig(c.certs, serverName))
+}
+
+func (c *RabbitClient) Send(ctx context.Context, queueName string, message []byte) (err error) {
+	ctx, span := startPublishSpan(ctx, queueName)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	headers := amqp.Table{}
+	otel.GetTextMapPropagator().Inject(ctx, headersCarrier(headers))
+	if id := requestid.FromContext(ctx); id != "" {
+		headers[requestid.Header] = id
+	}
+	return c.publish(ctx, queue{name: queueName}, amqp.Publishing{
+		ContentType: "application/json",
+		Headers:     headers,
+		Body:        message,
+	})
+}
+
+// queue is declared before every publish, so a publisher does not depend on the consumer having started.
+type queue struct {
+	name    string
+	durable bool
+	args    amqp.Table
+}
+
+// publish returns once the broker confirms msg, a message that is not confirmed in time may still be delivered.
+func (c *RabbitClient) publish(ctx context.Context, q queue, msg amqp.Publishing) error {
+	ch, err := c.current().Channel()
 	if err != nil {
 		c.logger.ErrorWithParams(
 			"get channel", map[string]string{
-				"queueName": queueName,
+				"queueName": q.name,
 			},
 			err,
 		)
+		return err
 	}
-	q, err := ch.QueueDeclare(
-		queueName, // name
-		false,     // durable
+	defer ch.Close()
+	_, err = ch.QueueDeclare(
+		q.name,    // name
+		q.durable, // durable
 		false,     // delete when unused
 		false,     // exclusive
 		false,     // no-wait
-		nil,       // arguments
+		q.args,    // arguments
 	)
 	if err != nil {
 		c.logger.ErrorWithParams(
 			"declare queue", map[string]string{
-				"queueName": queueName,
+				"queueName": q.name,
+			},
+			err,
+		)
+		return err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		c.logger.ErrorWithParams(
+			"enable publisher confirms", map[string]string{
+				"queueName": q.name,
 			},
 			err,
 		)
+		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	err = ch.PublishWithContext(ctx,
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx,
 		"",     // exchange
-		q.Name, // routing key
+		q.name, // routing key
 		false,  // mandatory
 		false,  // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        message,
-		})
-	return err
+		msg,
+	)
+	if err != nil {
+		return err
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %s : %w", ErrNotConfirmed, q.name, err)
+	}
+	if !acked {
+		return fmt.Errorf("%w: %s", ErrNotConfirmed, q.name)
+	}
+	return nil
 }
 
-func (c *RabbitClient) Consume(queueName string) (<-chan amqp.Delivery, error) {
-	ch, err := c.connection.Channel()
+// Consume delivers the messages of the queue with manual acknowledgement,
+// at most prefetch messages are delivered before they are acknowledged.
+func (c *RabbitClient) Consume(queueName string, prefetch int) (<-chan amqp.Delivery, error) {
+	ch, err := c.current().Channel()
 	if err != nil {
 		c.logger.ErrorWithParams(
 			"get channel", map[string]string{
@@ -82,18 +261,29 @@ func (c *RabbitClient) Consume(queueName string) (<-chan amqp.Delivery, error) {
 			},
 			err,
 		)
+		return nil, err
+	}
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		return nil, errors.Join(err, ch.Close())
 	}
 	messages, err := ch.Consume(
 		queueName, // queue
 		"",        // consumer
-		true,      // auto-ack
+		false,     // auto-ack
 		false,     // exclusive
 		false,     // no-local
 		false,     // no-wait
 		nil,       // args
 	)
 	if err != nil {
-		return nil, err
+		return nil, errors.Join(err, ch.Close())
+	}
+	return messages, nil
+}
+
+func (c *RabbitClient) Ping(_ context.Context) error {
+	if c.current().IsClosed() {
+		return ErrConnectionClosed
 	}
-	return messages, err
+	return nil
 }
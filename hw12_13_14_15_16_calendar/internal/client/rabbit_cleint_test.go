@@ -0,0 +1,54 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+)
+
+func writeCA(t *testing.T, path string, serial int64) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+}
+
+func TestDialReloadsCertificates(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	writeCA(t, caFile, 1)
+	// Nothing listens on the port, the certificates are loaded before the connection fails.
+	c := &RabbitClient{connectionString: "amqps://127.0.0.1:1/", tlsConf: config.ClientTLS{CAFile: caFile}}
+	_, err := c.dial()
+	require.Error(t, err)
+	require.NotNil(t, c.certs)
+	first := c.certs.CAPool()
+
+	writeCA(t, caFile, 2)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(caFile, future, future))
+	_, err = c.dial()
+	require.Error(t, err)
+	require.False(t, first.Equal(c.certs.CAPool()), "a redial uses the rotated CA")
+}
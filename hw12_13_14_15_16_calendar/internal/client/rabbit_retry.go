@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// AttemptsHeader counts the deliveries of a message that were retried.
+	AttemptsHeader = "x-attempts"
+	// ErrorHeader keeps the last error of a dead-lettered message.
+	ErrorHeader = "x-error"
+)
+
+// RetryQueue holds the retried messages of queueName until their expiration, then the broker
+// dead-letters them back to queueName. The broker expires only the message at the head of the queue,
+// so a message waits at least as long as the messages retried before it.
+func RetryQueue(queueName string) string {
+	return queueName + ".retry"
+}
+
+// DeadLetterQueue keeps the messages of queueName that can not be processed, until an operator handles them.
+func DeadLetterQueue(queueName string) string {
+	return queueName + ".dead"
+}
+
+// Attempts returns how many times msg was retried.
+func Attempts(msg amqp.Delivery) int {
+	switch v := msg.Headers[AttemptsHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// Retry publishes msg to the retry queue of queueName with the attempts incremented,
+// it is delivered from queueName again after delay. The caller acknowledges msg once Retry returns nil,
+// the copy is confirmed by the broker by then.
+func (c *RabbitClient) Retry(ctx context.Context, queueName string, msg amqp.Delivery, delay time.Duration) error {
+	headers := copyHeaders(msg.Headers)
+	headers[AttemptsHeader] = int64(Attempts(msg) + 1)
+	return c.publish(ctx, queue{
+		name: RetryQueue(queueName),
+		args: amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queueName,
+		},
+	}, amqp.Publishing{
+		ContentType: msg.ContentType,
+		Headers:     headers,
+		Expiration:  strconv.FormatInt(delay.Milliseconds(), 10),
+		Body:        msg.Body,
+	})
+}
+
+// DeadLetter publishes msg with reason to the durable dead-letter queue of queueName.
+// The caller acknowledges msg once DeadLetter returns nil, the copy is confirmed by the broker by then.
+func (c *RabbitClient) DeadLetter(ctx context.Context, queueName string, msg amqp.Delivery, reason error) error {
+	headers := copyHeaders(msg.Headers)
+	headers[ErrorHeader] = reason.Error()
+	return c.publish(ctx, queue{name: DeadLetterQueue(queueName), durable: true}, amqp.Publishing{
+		ContentType:  msg.ContentType,
+		Headers:      headers,
+		DeliveryMode: amqp.Persistent,
+		Body:         msg.Body,
+	})
+}
+
+func copyHeaders(headers amqp.Table) amqp.Table {
+	copied := make(amqp.Table, len(headers)+1)
+	for k, v := range headers {
+		copied[k] = v
+	}
+	return copied
+}
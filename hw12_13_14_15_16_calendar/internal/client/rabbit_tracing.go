@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/client")
+
+// headersCarrier lets the otel propagator read and write AMQP message headers.
+type headersCarrier amqp.Table
+
+func (h headersCarrier) Get(key string) string {
+	v, ok := h[key]
+	if !ok {
+		return ""
+	}
+	s, _ := v.(string)
+	return s
+}
+
+func (h headersCarrier) Set(key string, value string) {
+	h[key] = value
+}
+
+func (h headersCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func startPublishSpan(ctx context.Context, queueName string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, fmt.Sprintf("%s publish", queueName),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", queueName),
+			attribute.String("messaging.operation.type", "send"),
+		),
+	)
+}
+
+// StartConsumeSpan starts a span for processing msg, linked to the span that published it.
+func StartConsumeSpan(ctx context.Context, queueName string, msg amqp.Delivery) (context.Context, trace.Span) {
+	publishCtx := otel.GetTextMapPropagator().Extract(ctx, headersCarrier(msg.Headers))
+	return tracer.Start(ctx, fmt.Sprintf("%s process", queueName),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.LinkFromContext(publishCtx)),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", queueName),
+			attribute.String("messaging.operation.type", "process"),
+		),
+	)
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestConsumeSpanLinksToPublishSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	ctx, publish := startPublishSpan(context.Background(), "queue")
+	headers := amqp.Table{}
+	otel.GetTextMapPropagator().Inject(ctx, headersCarrier(headers))
+	publish.End()
+	require.NoError(t, headers.Validate())
+
+	_, process := StartConsumeSpan(context.Background(), "queue", amqp.Delivery{Headers: headers})
+	process.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.Len(t, spans[1].Links(), 1)
+	require.Equal(t, spans[0].SpanContext().TraceID(), spans[1].Links()[0].SpanContext.TraceID())
+	require.Equal(t, spans[0].SpanContext().SpanID(), spans[1].Links()[0].SpanContext.SpanID())
+}
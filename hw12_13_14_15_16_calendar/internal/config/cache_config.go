@@ -0,0 +1,18 @@
+package config
+
+import "time"
+
+// CacheConf enables the cache of events read by id, entries expire after TTL.
+type CacheConf struct {
+	Enabled bool          `yaml:"enabled"`
+	Size    int           `yaml:"size"`
+	TTL     time.Duration `yaml:"ttl"`
+}
+
+func defaultCacheConf() CacheConf {
+	return CacheConf{
+		Enabled: false,
+		Size:    10000,
+		TTL:     time.Minute,
+	}
+}
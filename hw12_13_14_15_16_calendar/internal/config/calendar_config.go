@@ -1,43 +1,69 @@
 package config
 
 import (
-	"context"
 	"fmt"
-
-	"github.com/heetch/confita"
-	"github.com/heetch/confita/backend/file"
-	"github.com/rs/zerolog/log"
 )
 
 type CalendarConfig struct {
-	Logger LoggerConf `config:"logging"`
-	DB     DBConf     `config:"db"`
-	Server Server     `config:"server"`
+	Logger  LoggerConf  `yaml:"logging"`
+	DB      DBConf      `yaml:"db"`
+	Cache   CacheConf   `yaml:"cache"`
+	Server  Server      `yaml:"server"`
+	Tracing TracingConf `yaml:"tracing"`
 }
 
-type LoggerConf struct {
-	Level string `config:"level,required"`
+type Server struct {
+	HTTPHost string    `yaml:"http-host"` //nolint:tagliatelle
+	HTTPPort int       `yaml:"http-port"` //nolint:tagliatelle
+	GRPCHost string    `yaml:"grpc-host"` //nolint:tagliatelle
+	GRPCPort int       `yaml:"grpc-port"` //nolint:tagliatelle
+	TLS      ServerTLS `yaml:"tls"`
 }
 
-type Server struct {
+type HTTPServer struct {
 	HTTPHost string `yaml:"http-host"` //nolint:tagliatelle
 	HTTPPort int    `yaml:"http-port"` //nolint:tagliatelle
-	GRPCHost string `yaml:"grpc-host"` //nolint:tagliatelle
-	GRPCPort int    `yaml:"grpc-port"` //nolint:tagliatelle
 }
 
+const (
+	DBDriverPostgres = "postgres"
+	DBDriverSQLite   = "sqlite"
+)
+
 type DBConf struct {
-	InMemory bool     `yaml:"in-memory"` //nolint:tagliatelle
-	Host     string   `config:"host"`
-	Port     int      `config:"port"`
-	User     string   `config:"user"`
-	Password string   `config:"password"`
-	Dbname   string   `config:"dbname"`
-	Tables   DBTables `config:"tables"`
+	InMemory    bool              `yaml:"in-memory"` //nolint:tagliatelle
+	Persistence MemoryPersistence `yaml:"persistence"`
+	// Driver selects the backend when InMemory is false, Path is the database file of sqlite.
+	Driver   string   `yaml:"driver"`
+	Path     string   `yaml:"path"`
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	User     string   `yaml:"user"`
+	Password string   `yaml:"password"`
+	Dbname   string   `yaml:"dbname"`
+	Tables   DBTables `yaml:"tables"`
+	Pool     DBPool   `yaml:"pool"`
+	Retry    DBRetry  `yaml:"retry"`
 }
 
 type DBTables struct {
-	Schema string `config:"schema"`
+	Schema string `yaml:"schema"`
+}
+
+func defaultDBConf() DBConf {
+	return DBConf{
+		InMemory:    false,
+		Persistence: defaultMemoryPersistence(),
+		Driver:      DBDriverPostgres,
+		Path:        "calendar.db",
+		Host:        "localhost",
+		Port:        5432,
+		User:        "postgres",
+		Password:    "postgres",
+		Dbname:      "postgres",
+		Pool:        defaultDBPool(),
+		Retry:       defaultDBRetry(),
+	}
 }
 
 func (c DBConf) CollectDsn() string {
@@ -46,28 +72,38 @@ func (c DBConf) CollectDsn() string {
 }
 
 func NewCalendarConfig(pathToYaml string) CalendarConfig {
+	return must(LoadCalendarConfig(pathToYaml))
+}
+
+// LoadCalendarConfig reads the config like NewCalendarConfig but returns problems instead of exiting.
+func LoadCalendarConfig(pathToYaml string) (CalendarConfig, error) {
 	cfg := CalendarConfig{
-		Logger: LoggerConf{
-			Level: "info",
-		},
-		DB: DBConf{
-			InMemory: false,
-			Host:     "localhost",
-			Port:     5432,
-			User:     "postgres",
-			Password: "postgres",
-			Dbname:   "postgres",
-		},
+		Logger: defaultLoggerConf(),
+		DB:     defaultDBConf(),
+		Cache:  defaultCacheConf(),
 		Server: Server{
 			HTTPHost: "localhost",
 			HTTPPort: 8080,
 			GRPCHost: "localhost",
 			GRPCPort: 50051,
+			TLS:      defaultServerTLS(),
 		},
+		Tracing: defaultTracingConf(),
 	}
-	loader := confita.NewLoader(file.NewBackend(pathToYaml))
-	if err := loader.Load(context.Background(), &cfg); err != nil {
-		log.Fatal().Err(err).Msg("failed to load config")
-	}
-	return cfg
+	err := load(pathToYaml, &cfg)
+	return cfg, err
+}
+
+func (c CalendarConfig) Validate() error {
+	var v validator
+	v.logger("logging", c.Logger)
+	v.db("db", c.DB)
+	v.cache("cache", c.Cache)
+	v.required("server.http-host", c.Server.HTTPHost)
+	v.port("server.http-port", c.Server.HTTPPort)
+	v.required("server.grpc-host", c.Server.GRPCHost)
+	v.port("server.grpc-port", c.Server.GRPCPort)
+	v.serverTLS("server.tls", c.Server.TLS)
+	v.tracing("tracing", c.Tracing)
+	return v.err()
 }
@@ -0,0 +1,39 @@
+package config
+
+import "time"
+
+// DBPool limits the postgres connection pool, zero MaxOpenConns and lifetimes mean no limit.
+type DBPool struct {
+	MaxOpenConns    int           `yaml:"max-open-conns"`     //nolint:tagliatelle
+	MaxIdleConns    int           `yaml:"max-idle-conns"`     //nolint:tagliatelle
+	ConnMaxLifetime time.Duration `yaml:"conn-max-lifetime"`  //nolint:tagliatelle
+	ConnMaxIdleTime time.Duration `yaml:"conn-max-idle-time"` //nolint:tagliatelle
+}
+
+// DBRetry controls how long a binary waits for postgres at startup and how often
+// idempotent queries are repeated after a transient error. The delay between attempts
+// starts at InitialBackoff and doubles up to MaxBackoff.
+type DBRetry struct {
+	StartupTimeout time.Duration `yaml:"startup-timeout"` //nolint:tagliatelle
+	Attempts       int           `yaml:"attempts"`
+	InitialBackoff time.Duration `yaml:"initial-backoff"` //nolint:tagliatelle
+	MaxBackoff     time.Duration `yaml:"max-backoff"`     //nolint:tagliatelle
+}
+
+func defaultDBPool() DBPool {
+	return DBPool{
+		MaxOpenConns:    20,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+	}
+}
+
+func defaultDBRetry() DBRetry {
+	return DBRetry{
+		StartupTimeout: time.Minute,
+		Attempts:       3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	}
+}
@@ -0,0 +1,65 @@
+package config
+
+import "time"
+
+const (
+	ChannelLog     = "log"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// DeliveryConf sets how the sender delivers notifications. A user listed in Users gets them by the chosen
+// channel and locale, the others by DefaultChannel in DefaultLocale. Templates override the built-in
+// subject and body of a channel per locale.
+type DeliveryConf struct {
+	DefaultChannel string                             `yaml:"default-channel"` //nolint:tagliatelle
+	DefaultLocale  string                             `yaml:"default-locale"`  //nolint:tagliatelle
+	Users          []UserPreference                   `yaml:"users"`
+	SMTP           SMTPConf                           `yaml:"smtp"`
+	Webhook        WebhookConf                        `yaml:"webhook"`
+	Templates      map[string]map[string]TemplateConf `yaml:"templates"`
+}
+
+// UserPreference is the channel and locale of a user, with the address for the channel.
+type UserPreference struct {
+	ID         string `yaml:"id"`
+	Channel    string `yaml:"channel"`
+	Locale     string `yaml:"locale"`
+	Email      string `yaml:"email"`
+	WebhookURL string `yaml:"webhook-url"` //nolint:tagliatelle
+}
+
+// SMTPConf is the server that sends emails, STARTTLS is used when the server offers it.
+// Without Username the server is used without authentication.
+type SMTPConf struct {
+	Host     string        `yaml:"host"`
+	Port     int           `yaml:"port"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	From     string        `yaml:"from"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+type WebhookConf struct {
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// TemplateConf holds text/template sources, the notification is passed as the data.
+type TemplateConf struct {
+	Subject string `yaml:"subject"`
+	Body    string `yaml:"body"`
+}
+
+func defaultDeliveryConf() DeliveryConf {
+	return DeliveryConf{
+		DefaultChannel: ChannelLog,
+		DefaultLocale:  "en",
+		SMTP: SMTPConf{
+			Port:    25,
+			Timeout: 10 * time.Second,
+		},
+		Webhook: WebhookConf{
+			Timeout: 5 * time.Second,
+		},
+	}
+}
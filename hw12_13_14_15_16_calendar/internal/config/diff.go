@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const maskedValue = "***"
+
+// Change is a value that differs between two configs, Key is its yaml path.
+type Change struct {
+	Key string
+	Old string
+	New string
+}
+
+// Diff lists the values changed between two configs of the same type.
+// Secrets are masked so the result can be logged.
+func Diff(prev, next any) []Change {
+	var changes []Change
+	diffValues(reflect.ValueOf(prev), reflect.ValueOf(next), "", &changes)
+	return changes
+}
+
+func diffValues(prev, next reflect.Value, key string, changes *[]Change) {
+	if prev.Kind() == reflect.Struct {
+		t := prev.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			if key != "" {
+				name = key + "." + name
+			}
+			diffValues(prev.Field(i), next.Field(i), name, changes)
+		}
+		return
+	}
+	if reflect.DeepEqual(prev.Interface(), next.Interface()) {
+		return
+	}
+	change := Change{Key: key, Old: fmt.Sprint(prev.Interface()), New: fmt.Sprint(next.Interface())}
+	if isSecret(key) {
+		change.Old, change.New = maskedValue, maskedValue
+	}
+	*changes = append(*changes, change)
+}
+
+func isSecret(key string) bool {
+	return strings.HasSuffix(key, "password") || strings.HasSuffix(key, "connection-string")
+}
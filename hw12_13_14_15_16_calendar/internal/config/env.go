@@ -0,0 +1,157 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heetch/confita/backend"
+)
+
+// EnvPrefix starts the names of environment variables overriding the yaml config.
+//
+// The name of a variable is the prefix followed by the yaml path of the value,
+// upper-cased with dashes and nesting replaced by underscores:
+//
+//	db.host                  -> CALENDAR_DB_HOST
+//	server.http-port         -> CALENDAR_SERVER_HTTP_PORT
+//	rabbit.connection-string -> CALENDAR_RABBIT_CONNECTION_STRING
+//
+// Secrets can be kept in files: a variable with the _FILE suffix holds a path,
+// the trimmed content of that file is used as the value, e.g. CALENDAR_DB_PASSWORD_FILE=/run/secrets/db.
+// Lists are comma separated.
+const EnvPrefix = "CALENDAR"
+
+const envFileSuffix = "_FILE"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+type envBackend struct {
+	prefix string
+}
+
+func newEnvBackend(prefix string) *envBackend {
+	return &envBackend{prefix: prefix}
+}
+
+func (b *envBackend) Name() string {
+	return "env"
+}
+
+// Get is not used, values are resolved by Unmarshal from the yaml paths of the fields.
+func (b *envBackend) Get(context.Context, string) ([]byte, error) {
+	return nil, backend.ErrNotFound
+}
+
+func (b *envBackend) Unmarshal(_ context.Context, to interface{}) error {
+	v := reflect.ValueOf(to)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("env backend expects a pointer to struct")
+	}
+	var errs []error
+	b.unmarshalStruct(v.Elem(), b.prefix, &errs)
+	return errors.Join(errs...)
+}
+
+func (b *envBackend) unmarshalStruct(v reflect.Value, name string, errs *[]error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if !field.IsExported() || key == "-" {
+			continue
+		}
+		if key == "" {
+			key = field.Name
+		}
+		fieldName := name + "_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			b.unmarshalStruct(fv, fieldName, errs)
+			continue
+		}
+		raw, ok, err := lookupEnv(fieldName)
+		if err != nil {
+			*errs = append(*errs, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := setValue(fv, raw); err != nil {
+			*errs = append(*errs, fmt.Errorf("%s: %w", fieldName, err))
+		}
+	}
+}
+
+func lookupEnv(name string) (string, bool, error) {
+	if raw, ok := os.LookupEnv(name); ok {
+		return raw, true, nil
+	}
+	path, ok := os.LookupEnv(name + envFileSuffix)
+	if !ok {
+		return "", false, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s%s: %w", name, envFileSuffix, err)
+	}
+	return strings.TrimSpace(string(content)), true, nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() { //nolint:exhaustive
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		parts := strings.Split(raw, ",")
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setValue(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
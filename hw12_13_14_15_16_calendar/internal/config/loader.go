@@ -0,0 +1,42 @@
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/heetch/confita"
+	"github.com/heetch/confita/backend"
+	"github.com/heetch/confita/backend/file"
+	"github.com/rs/zerolog/log"
+)
+
+type validatable interface {
+	Validate() error
+}
+
+func must[T any](cfg T, err error) T {
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load config")
+	}
+	return cfg
+}
+
+// load fills cfg from the yaml file, environment overrides and validates the result.
+// An empty path skips the file, so a binary can be configured with environment variables only.
+func load(pathToYaml string, cfg validatable) error {
+	var backends []backend.Backend
+	if pathToYaml != "" {
+		backends = append(backends, file.NewBackend(pathToYaml))
+	}
+	backends = append(backends, newEnvBackend(EnvPrefix))
+
+	loader := confita.NewLoader(backends...)
+	loader.Tag = "yaml"
+	if err := loader.Load(context.Background(), cfg); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package config
+
+import "time"
+
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+type LoggerConf struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+	// Components override Level for the loggers of a component, empty values fall back to Level.
+	Components LogComponents `yaml:"components"`
+	Sampling   LogSampling   `yaml:"sampling"`
+	// Redact lists param names whose values are replaced in log lines.
+	Redact []string `yaml:"redact"`
+}
+
+type LogComponents struct {
+	Server    string `yaml:"server"`
+	Service   string `yaml:"service"`
+	Scheduler string `yaml:"scheduler"`
+	Sender    string `yaml:"sender"`
+	Storage   string `yaml:"storage"`
+}
+
+// LogSampling thins out access logs: within every period the first burst lines are written,
+// after that only every n-th line.
+type LogSampling struct {
+	Enabled bool          `yaml:"enabled"`
+	Burst   uint32        `yaml:"burst"`
+	Period  time.Duration `yaml:"period"`
+	Every   uint32        `yaml:"every"`
+}
+
+func defaultLoggerConf() LoggerConf {
+	return LoggerConf{
+		Level:  "info",
+		Format: LogFormatJSON,
+		Sampling: LogSampling{
+			Enabled: false,
+			Burst:   100,
+			Period:  time.Second,
+			Every:   10,
+		},
+		Redact: []string{"description"},
+	}
+}
@@ -0,0 +1,31 @@
+package config
+
+import "time"
+
+const (
+	FsyncAlways   = "always"
+	FsyncInterval = "interval"
+	FsyncNever    = "never"
+)
+
+// MemoryPersistence keeps the events of the in-memory storage on disk: every change is appended
+// to a write-ahead log in Dir and the log is compacted into a snapshot every SnapshotInterval.
+type MemoryPersistence struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"`
+	// Fsync is always to sync every change, interval to sync every FsyncInterval
+	// or never to leave it to the operating system.
+	Fsync            string        `yaml:"fsync"`
+	FsyncInterval    time.Duration `yaml:"fsync-interval"`    //nolint:tagliatelle
+	SnapshotInterval time.Duration `yaml:"snapshot-interval"` //nolint:tagliatelle
+}
+
+func defaultMemoryPersistence() MemoryPersistence {
+	return MemoryPersistence{
+		Enabled:          false,
+		Dir:              "data",
+		Fsync:            FsyncInterval,
+		FsyncInterval:    time.Second,
+		SnapshotInterval: 5 * time.Minute,
+	}
+}
@@ -1,45 +1,162 @@
 package config
 
-import (
-	"context"
-
-	"github.com/heetch/confita"
-	"github.com/heetch/confita/backend/file"
-	"github.com/rs/zerolog/log"
-)
+import "time"
 
 type CalendarSchedulerConfig struct {
-	Rabbit Rabbit                        `config:"rabbit"`
-	Logger CalendarSchedulerLoggerConfig `config:"logging"`
-	DB     DBConf                        `config:"db"`
+	Rabbit        Rabbit            `yaml:"rabbit"`
+	Logger        LoggerConf        `yaml:"logging"`
+	DB            DBConf            `yaml:"db"`
+	Server        HTTPServer        `yaml:"server"`
+	Tracing       TracingConf       `yaml:"tracing"`
+	Jobs          []JobConf         `yaml:"jobs"`
+	Notifications NotificationsConf `yaml:"notifications"`
+	Retention     RetentionConf     `yaml:"retention"`
+	Election      ElectionConf      `yaml:"election"`
+	Admin         AdminConf         `yaml:"admin"`
 }
 
-type Rabbit struct {
-	ConnectionString string `yaml:"connection-string"` //nolint:tagliatelle
-	QueueName        string `yaml:"queue"`
+// AdminConf enables the admin API that lists, triggers and pauses the jobs.
+// The latest HistorySize runs are kept in memory.
+type AdminConf struct {
+	Enabled     bool   `yaml:"enabled"`
+	HTTPHost    string `yaml:"http-host"`    //nolint:tagliatelle
+	HTTPPort    int    `yaml:"http-port"`    //nolint:tagliatelle
+	HistorySize int    `yaml:"history-size"` //nolint:tagliatelle
+}
+
+// ElectionConf lets replicas sharing a postgres database elect one of them to run the jobs.
+// Interval is how often followers try to take over and the leader checks its connection.
+type ElectionConf struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
 }
 
-type CalendarSchedulerLoggerConfig struct {
-	Level string `config:"level,required"`
+// JobConf declares a scheduler job, Name selects one of the built-in jobs. The job runs by Cron
+// or every Interval. A singleton job skips a run while the previous one is still running.
+// Every run waits a random duration up to Jitter first and is cancelled after Timeout.
+type JobConf struct {
+	Name      string        `yaml:"name"`
+	Enabled   bool          `yaml:"enabled"`
+	Cron      string        `yaml:"cron"`
+	Interval  time.Duration `yaml:"interval"`
+	Timeout   time.Duration `yaml:"timeout"`
+	Singleton bool          `yaml:"singleton"`
+	Jitter    time.Duration `yaml:"jitter"`
+}
+
+// UnmarshalYAML enables a declared job unless it sets enabled: false.
+func (j *JobConf) UnmarshalYAML(unmarshal func(any) error) error {
+	type plain JobConf
+	p := plain{Enabled: true}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	*j = JobConf(p)
+	return nil
+}
+
+// NotificationsConf sets how late a missed notification is still published, for example after downtime.
+// Older pending notifications are marked as expired. A notification claimed but not published within
+// ClaimTimeout, because the scheduler stopped, is claimed again.
+type NotificationsConf struct {
+	GraceWindow  time.Duration `yaml:"grace-window"`  //nolint:tagliatelle
+	ClaimTimeout time.Duration `yaml:"claim-timeout"` //nolint:tagliatelle
+}
+
+// maxRetentionBatchSize keeps the ids of a batch below the bind parameter limits of postgres and sqlite.
+const maxRetentionBatchSize = 10000
+
+// RetentionConf sets how long events are kept before the cleanup job deletes them.
+// The job deletes BatchSize events per statement, with DryRun it only reports how many it would delete.
+type RetentionConf struct {
+	Period    time.Duration `yaml:"period"`
+	BatchSize int           `yaml:"batch-size"` //nolint:tagliatelle
+	DryRun    bool          `yaml:"dry-run"`    //nolint:tagliatelle
+	Archive   ArchiveConf   `yaml:"archive"`
+}
+
+// ArchiveConf enables gzipped JSON lines files in Dir with the events before they are deleted.
+type ArchiveConf struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"`
+}
+
+type Rabbit struct {
+	ConnectionString string    `yaml:"connection-string"` //nolint:tagliatelle
+	QueueName        string    `yaml:"queue"`
+	TLS              ClientTLS `yaml:"tls"`
 }
 
 func NewSchedulerConfig(pathToYaml string) CalendarSchedulerConfig {
+	return must(LoadSchedulerConfig(pathToYaml))
+}
+
+// LoadSchedulerConfig reads the config like NewSchedulerConfig but returns problems instead of exiting.
+func LoadSchedulerConfig(pathToYaml string) (CalendarSchedulerConfig, error) {
 	cfg := CalendarSchedulerConfig{
-		Logger: CalendarSchedulerLoggerConfig{
-			Level: "info",
+		Logger: defaultLoggerConf(),
+		DB:     defaultDBConf(),
+		Server: HTTPServer{
+			HTTPHost: "localhost",
+			HTTPPort: 8081,
+		},
+		Tracing: defaultTracingConf(),
+		Jobs: []JobConf{
+			{Name: "send_events", Enabled: true, Cron: "* * * * *", Timeout: 50 * time.Second, Singleton: true},
+			{Name: "delete_old_events", Enabled: true, Cron: "0 0 * * *", Timeout: time.Hour, Singleton: true},
+		},
+		Notifications: NotificationsConf{
+			GraceWindow:  15 * time.Minute,
+			ClaimTimeout: 5 * time.Minute,
+		},
+		Election: ElectionConf{
+			Enabled:  true,
+			Interval: 5 * time.Second,
 		},
-		DB: DBConf{
-			InMemory: false,
-			Host:     "localhost",
-			Port:     5432,
-			User:     "postgres",
-			Password: "postgres",
-			Dbname:   "postgres",
+		Admin: AdminConf{
+			Enabled:     true,
+			HTTPHost:    "localhost",
+			HTTPPort:    8083,
+			HistorySize: 100,
 		},
+		Retention: RetentionConf{
+			Period:    365 * 24 * time.Hour,
+			BatchSize: 500,
+			Archive: ArchiveConf{
+				Enabled: false,
+				Dir:     "archive",
+			},
+		},
+	}
+	err := load(pathToYaml, &cfg)
+	return cfg, err
+}
+
+func (c CalendarSchedulerConfig) Validate() error {
+	var v validator
+	v.rabbit("rabbit", c.Rabbit)
+	v.logger("logging", c.Logger)
+	v.db("db", c.DB)
+	v.required("server.http-host", c.Server.HTTPHost)
+	v.port("server.http-port", c.Server.HTTPPort)
+	v.tracing("tracing", c.Tracing)
+	v.jobs("jobs", c.Jobs)
+	if c.Notifications.GraceWindow <= 0 {
+		v.fail("notifications.grace-window", "must be positive")
+	}
+	if c.Notifications.ClaimTimeout <= 0 {
+		v.fail("notifications.claim-timeout", "must be positive")
+	}
+	v.retention("retention", c.Retention)
+	if c.Election.Enabled && c.Election.Interval <= 0 {
+		v.fail("election.interval", "must be positive")
+	}
+	if c.Admin.Enabled {
+		v.required("admin.http-host", c.Admin.HTTPHost)
+		v.port("admin.http-port", c.Admin.HTTPPort)
 	}
-	loader := confita.NewLoader(file.NewBackend(pathToYaml))
-	if err := loader.Load(context.Background(), &cfg); err != nil {
-		log.Fatal().Err(err).Msg("failed to load config")
+	if c.Admin.HistorySize < 0 {
+		v.fail("admin.history-size", "must not be negative")
 	}
-	return cfg
+	return v.err()
 }
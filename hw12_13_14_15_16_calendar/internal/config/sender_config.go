@@ -1,32 +1,62 @@
 package config
 
-import (
-	"context"
-
-	"github.com/heetch/confita"
-	"github.com/heetch/confita/backend/file"
-	"github.com/rs/zerolog/log"
-)
+import "time"
 
 type CalendarSenderConfig struct {
-	Rabbit Rabbit                     `config:"rabbit"`
-	DB     DBConf                     `config:"db"`
-	Logger CalendarSenderLoggerConfig `config:"logging"`
+	Rabbit   Rabbit       `yaml:"rabbit"`
+	DB       DBConf       `yaml:"db"`
+	Logger   LoggerConf   `yaml:"logging"`
+	Server   HTTPServer   `yaml:"server"`
+	Tracing  TracingConf  `yaml:"tracing"`
+	Consumer ConsumerConf `yaml:"consumer"`
+	Delivery DeliveryConf `yaml:"delivery"`
 }
 
-type CalendarSenderLoggerConfig struct {
-	Level string `config:"level,required"`
+// ConsumerConf limits the unacknowledged messages to Prefetch. A failed message is delivered again
+// after a backoff from InitialBackoff doubling up to MaxBackoff, after MaxAttempts deliveries
+// it goes to the dead-letter queue.
+type ConsumerConf struct {
+	Prefetch       int           `yaml:"prefetch"`
+	MaxAttempts    int           `yaml:"max-attempts"`    //nolint:tagliatelle
+	InitialBackoff time.Duration `yaml:"initial-backoff"` //nolint:tagliatelle
+	MaxBackoff     time.Duration `yaml:"max-backoff"`     //nolint:tagliatelle
 }
 
 func NewSenderConfig(pathToYaml string) CalendarSenderConfig {
+	return must(LoadSenderConfig(pathToYaml))
+}
+
+// LoadSenderConfig reads the config like NewSenderConfig but returns problems instead of exiting.
+func LoadSenderConfig(pathToYaml string) (CalendarSenderConfig, error) {
 	cfg := CalendarSenderConfig{
-		Logger: CalendarSenderLoggerConfig{
-			Level: "info",
+		Logger: defaultLoggerConf(),
+		DB:     defaultDBConf(),
+		Server: HTTPServer{
+			HTTPHost: "localhost",
+			HTTPPort: 8082,
 		},
+		Tracing: defaultTracingConf(),
+		Consumer: ConsumerConf{
+			Prefetch:       10,
+			MaxAttempts:    5,
+			InitialBackoff: time.Second,
+			MaxBackoff:     5 * time.Minute,
+		},
+		Delivery: defaultDeliveryConf(),
 	}
-	loader := confita.NewLoader(file.NewBackend(pathToYaml))
-	if err := loader.Load(context.Background(), &cfg); err != nil {
-		log.Fatal().Err(err).Msg("failed to load config")
-	}
-	return cfg
+	err := load(pathToYaml, &cfg)
+	return cfg, err
+}
+
+func (c CalendarSenderConfig) Validate() error {
+	var v validator
+	v.rabbit("rabbit", c.Rabbit)
+	v.logger("logging", c.Logger)
+	v.db("db", c.DB)
+	v.required("server.http-host", c.Server.HTTPHost)
+	v.port("server.http-port", c.Server.HTTPPort)
+	v.tracing("tracing", c.Tracing)
+	v.consumer("consumer", c.Consumer)
+	v.delivery("delivery", c.Delivery)
+	return v.err()
 }
@@ -0,0 +1,33 @@
+package config
+
+import "time"
+
+// ServerTLS secures the gRPC and HTTP listeners.
+// With ClientCAFile set clients must present a certificate signed by it.
+type ServerTLS struct {
+	Enabled        bool          `yaml:"enabled"`
+	CertFile       string        `yaml:"cert-file"`       //nolint:tagliatelle
+	KeyFile        string        `yaml:"key-file"`        //nolint:tagliatelle
+	ClientCAFile   string        `yaml:"client-ca-file"`  //nolint:tagliatelle
+	ReloadInterval time.Duration `yaml:"reload-interval"` //nolint:tagliatelle
+	Gateway        ClientTLS     `yaml:"gateway"`
+}
+
+// ClientTLS configures an outgoing TLS connection.
+// CAFile replaces the system pool, CertFile and KeyFile are presented to servers requiring mutual TLS.
+type ClientTLS struct {
+	CertFile   string `yaml:"cert-file"`   //nolint:tagliatelle
+	KeyFile    string `yaml:"key-file"`    //nolint:tagliatelle
+	CAFile     string `yaml:"ca-file"`     //nolint:tagliatelle
+	ServerName string `yaml:"server-name"` //nolint:tagliatelle
+}
+
+func defaultServerTLS() ServerTLS {
+	return ServerTLS{
+		Enabled:        false,
+		ReloadInterval: 30 * time.Second,
+		Gateway: ClientTLS{
+			ServerName: "localhost",
+		},
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+const (
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+type TracingConf struct {
+	Enabled     bool    `yaml:"enabled"`
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	SampleRatio float64 `yaml:"sample-ratio"` //nolint:tagliatelle
+}
+
+func defaultTracingConf() TracingConf {
+	return TracingConf{
+		Enabled:     false,
+		Exporter:    TracingExporterStdout,
+		Endpoint:    "localhost:4317",
+		Insecure:    true,
+		SampleRatio: 1,
+	}
+}
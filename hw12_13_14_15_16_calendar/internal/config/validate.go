@@ -0,0 +1,338 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/mail"
+	"net/url"
+	"slices"
+	"text/template"
+
+	"github.com/google/uuid"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog"
+)
+
+var ErrInvalidValue = errors.New("invalid value")
+
+// validator collects all problems of a config, so they are reported at once.
+type validator struct {
+	errs []error
+}
+
+func (v *validator) fail(key string, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%w %s: %s", ErrInvalidValue, key, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) err() error {
+	return errors.Join(v.errs...)
+}
+
+func (v *validator) required(key, value string) {
+	if value == "" {
+		v.fail(key, "must be set")
+	}
+}
+
+func (v *validator) port(key string, value int) {
+	if value < 1 || value > 65535 {
+		v.fail(key, "port %d is out of range 1-65535", value)
+	}
+}
+
+func (v *validator) cron(key, value string) {
+	if _, err := cron.ParseStandard(value); err != nil {
+		v.fail(key, "%s", err)
+	}
+}
+
+func (v *validator) logger(key string, c LoggerConf) {
+	v.level(key+".level", c.Level)
+	for name, level := range map[string]string{
+		"server":    c.Components.Server,
+		"service":   c.Components.Service,
+		"scheduler": c.Components.Scheduler,
+		"sender":    c.Components.Sender,
+		"storage":   c.Components.Storage,
+	} {
+		if level != "" {
+			v.level(key+".components."+name, level)
+		}
+	}
+	if c.Format != LogFormatJSON && c.Format != LogFormatConsole {
+		v.fail(key+".format", "must be %s or %s", LogFormatJSON, LogFormatConsole)
+	}
+	if c.Sampling.Enabled && (c.Sampling.Period <= 0 || c.Sampling.Every == 0) {
+		v.fail(key+".sampling", "period and every must be positive")
+	}
+}
+
+func (v *validator) level(key, level string) {
+	if _, err := zerolog.ParseLevel(level); err != nil || level == "" {
+		v.fail(key, "unknown level %q", level)
+	}
+}
+
+func (v *validator) db(key string, c DBConf) {
+	if c.InMemory {
+		v.persistence(key+".persistence", c.Persistence)
+		return
+	}
+	switch c.Driver {
+	case DBDriverPostgres:
+	case DBDriverSQLite:
+		v.required(key+".path", c.Path)
+		return
+	default:
+		v.fail(key+".driver", "must be %s or %s", DBDriverPostgres, DBDriverSQLite)
+		return
+	}
+	v.required(key+".host", c.Host)
+	v.port(key+".port", c.Port)
+	v.required(key+".user", c.User)
+	v.required(key+".dbname", c.Dbname)
+	v.pool(key+".pool", c.Pool)
+	v.retry(key+".retry", c.Retry)
+}
+
+func (v *validator) pool(key string, c DBPool) {
+	if c.MaxOpenConns < 0 {
+		v.fail(key+".max-open-conns", "must not be negative")
+	}
+	if c.MaxIdleConns < 0 {
+		v.fail(key+".max-idle-conns", "must not be negative")
+	}
+	if c.MaxOpenConns > 0 && c.MaxIdleConns > c.MaxOpenConns {
+		v.fail(key+".max-idle-conns", "must not exceed max-open-conns %d", c.MaxOpenConns)
+	}
+	if c.ConnMaxLifetime < 0 {
+		v.fail(key+".conn-max-lifetime", "must not be negative")
+	}
+	if c.ConnMaxIdleTime < 0 {
+		v.fail(key+".conn-max-idle-time", "must not be negative")
+	}
+}
+
+func (v *validator) retry(key string, c DBRetry) {
+	if c.StartupTimeout < 0 {
+		v.fail(key+".startup-timeout", "must not be negative")
+	}
+	if c.Attempts < 1 {
+		v.fail(key+".attempts", "must be at least 1")
+	}
+	if c.InitialBackoff <= 0 {
+		v.fail(key+".initial-backoff", "must be positive")
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		v.fail(key+".max-backoff", "must not be less than initial-backoff")
+	}
+}
+
+func (v *validator) consumer(key string, c ConsumerConf) {
+	if c.Prefetch < 1 {
+		v.fail(key+".prefetch", "must be at least 1")
+	}
+	if c.MaxAttempts < 1 {
+		v.fail(key+".max-attempts", "must be at least 1")
+	}
+	if c.InitialBackoff <= 0 {
+		v.fail(key+".initial-backoff", "must be positive")
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		v.fail(key+".max-backoff", "must not be less than initial-backoff")
+	}
+}
+
+func (v *validator) delivery(key string, c DeliveryConf) {
+	v.channel(key+".default-channel", c.DefaultChannel)
+	v.required(key+".default-locale", c.DefaultLocale)
+	email := c.DefaultChannel == ChannelEmail
+	ids := make(map[string]bool, len(c.Users))
+	for i, u := range c.Users {
+		userKey := fmt.Sprintf("%s.users[%d]", key, i)
+		if _, err := uuid.Parse(u.ID); err != nil {
+			v.fail(userKey+".id", "must be a uuid")
+		} else if ids[u.ID] {
+			v.fail(userKey+".id", "is declared twice")
+		}
+		ids[u.ID] = true
+		channel := u.Channel
+		if channel == "" {
+			channel = c.DefaultChannel
+		} else {
+			v.channel(userKey+".channel", channel)
+		}
+		switch channel {
+		case ChannelEmail:
+			email = true
+			if _, err := mail.ParseAddress(u.Email); err != nil {
+				v.fail(userKey+".email", "must be an email address")
+			}
+		case ChannelWebhook:
+			if parsed, err := url.Parse(u.WebhookURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				v.fail(userKey+".webhook-url", "must be an http:// or https:// url")
+			}
+		}
+	}
+	if email {
+		v.required(key+".smtp.host", c.SMTP.Host)
+		v.port(key+".smtp.port", c.SMTP.Port)
+		if _, err := mail.ParseAddress(c.SMTP.From); err != nil {
+			v.fail(key+".smtp.from", "must be an email address")
+		}
+	}
+	if c.SMTP.Timeout <= 0 {
+		v.fail(key+".smtp.timeout", "must be positive")
+	}
+	if c.Webhook.Timeout <= 0 {
+		v.fail(key+".webhook.timeout", "must be positive")
+	}
+	// Keys are sorted, so the problems are reported in a stable order.
+	for _, channel := range slices.Sorted(maps.Keys(c.Templates)) {
+		v.channel(key+".templates."+channel, channel)
+		for _, locale := range slices.Sorted(maps.Keys(c.Templates[channel])) {
+			t := c.Templates[channel][locale]
+			templateKey := key + ".templates." + channel + "." + locale
+			if _, err := template.New("").Parse(t.Subject); err != nil {
+				v.fail(templateKey+".subject", "%s", err)
+			}
+			if _, err := template.New("").Parse(t.Body); err != nil {
+				v.fail(templateKey+".body", "%s", err)
+			}
+		}
+	}
+}
+
+func (v *validator) channel(key, channel string) {
+	switch channel {
+	case ChannelLog, ChannelEmail, ChannelWebhook:
+	default:
+		v.fail(key, "unknown channel %q, use log, email or webhook", channel)
+	}
+}
+
+func (v *validator) cache(key string, c CacheConf) {
+	if !c.Enabled {
+		return
+	}
+	if c.Size <= 0 {
+		v.fail(key+".size", "must be positive")
+	}
+	if c.TTL <= 0 {
+		v.fail(key+".ttl", "must be positive")
+	}
+}
+
+func (v *validator) jobs(key string, jobs []JobConf) {
+	names := make(map[string]bool, len(jobs))
+	for i, j := range jobs {
+		// Jobs are reported by name, unnamed ones by index.
+		jobKey := fmt.Sprintf("%s[%d]", key, i)
+		if j.Name == "" {
+			v.fail(jobKey+".name", "must be set")
+		} else {
+			jobKey = key + "." + j.Name
+			if names[j.Name] {
+				v.fail(jobKey, "is declared twice")
+			}
+			names[j.Name] = true
+		}
+		switch {
+		case (j.Cron == "") == (j.Interval == 0):
+			v.fail(jobKey, "set either cron or interval")
+		case j.Cron != "":
+			v.cron(jobKey+".cron", j.Cron)
+		case j.Interval < 0:
+			v.fail(jobKey+".interval", "must be positive")
+		}
+		if j.Timeout < 0 {
+			v.fail(jobKey+".timeout", "must not be negative")
+		}
+		if j.Jitter < 0 {
+			v.fail(jobKey+".jitter", "must not be negative")
+		}
+	}
+}
+
+func (v *validator) retention(key string, c RetentionConf) {
+	if c.Period <= 0 {
+		v.fail(key+".period", "must be positive")
+	}
+	if c.BatchSize < 1 || c.BatchSize > maxRetentionBatchSize {
+		v.fail(key+".batch-size", "%d is out of range 1-%d", c.BatchSize, maxRetentionBatchSize)
+	}
+	if c.Archive.Enabled {
+		v.required(key+".archive.dir", c.Archive.Dir)
+	}
+}
+
+func (v *validator) persistence(key string, c MemoryPersistence) {
+	if !c.Enabled {
+		return
+	}
+	v.required(key+".dir", c.Dir)
+	switch c.Fsync {
+	case FsyncAlways, FsyncNever:
+	case FsyncInterval:
+		if c.FsyncInterval <= 0 {
+			v.fail(key+".fsync-interval", "must be positive")
+		}
+	default:
+		v.fail(key+".fsync", "must be %s, %s or %s", FsyncAlways, FsyncInterval, FsyncNever)
+	}
+	if c.SnapshotInterval <= 0 {
+		v.fail(key+".snapshot-interval", "must be positive")
+	}
+}
+
+func (v *validator) rabbit(key string, c Rabbit) {
+	v.required(key+".queue", c.QueueName)
+	u, err := url.Parse(c.ConnectionString)
+	if err != nil || (u.Scheme != "amqp" && u.Scheme != "amqps") || u.Host == "" {
+		v.fail(key+".connection-string", "must be an amqp:// or amqps:// url")
+		return
+	}
+	if u.Scheme == "amqp" && (c.TLS.CAFile != "" || c.TLS.CertFile != "") {
+		v.fail(key+".tls", "is set but the connection string is not amqps://")
+	}
+	v.keyPair(key+".tls", c.TLS.CertFile, c.TLS.KeyFile)
+}
+
+func (v *validator) serverTLS(key string, c ServerTLS) {
+	if !c.Enabled {
+		return
+	}
+	v.required(key+".cert-file", c.CertFile)
+	v.required(key+".key-file", c.KeyFile)
+	if c.ReloadInterval <= 0 {
+		v.fail(key+".reload-interval", "must be positive")
+	}
+	v.keyPair(key+".gateway", c.Gateway.CertFile, c.Gateway.KeyFile)
+	if c.ClientCAFile != "" && c.Gateway.CertFile == "" {
+		v.fail(key+".gateway.cert-file", "must be set when client certificates are required")
+	}
+}
+
+func (v *validator) keyPair(key, certFile, keyFile string) {
+	if (certFile == "") != (keyFile == "") {
+		v.fail(key, "cert-file and key-file must be set together")
+	}
+}
+
+func (v *validator) tracing(key string, c TracingConf) {
+	if !c.Enabled {
+		return
+	}
+	switch c.Exporter {
+	case TracingExporterStdout:
+	case TracingExporterOTLP:
+		v.required(key+".endpoint", c.Endpoint)
+	default:
+		v.fail(key+".exporter", "unknown exporter %q", c.Exporter)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		v.fail(key+".sample-ratio", "%v is out of range 0-1", c.SampleRatio)
+	}
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+// Check reports an error when the dependency it watches can not be used.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type Checker struct {
+	mu     sync.RWMutex
+	checks []namedCheck
+}
+
+type report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Ready runs all checks and returns the failed ones by name.
+func (c *Checker) Ready(ctx context.Context) map[string]error {
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	failed := make(map[string]error)
+	for _, nc := range checks {
+		if err := nc.check(ctx); err != nil {
+			failed[nc.name] = err
+		}
+	}
+	return failed
+}
+
+// Register adds /healthz and /readyz to mux.
+// Liveness only tells that the process serves http, readiness runs the checks.
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeReport(w, http.StatusOK, report{Status: "ok"})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		failed := c.Ready(r.Context())
+		if len(failed) == 0 {
+			writeReport(w, http.StatusOK, report{Status: "ok"})
+			return
+		}
+		checks := make(map[string]string, len(failed))
+		for name, err := range failed {
+			checks[name] = err.Error()
+		}
+		writeReport(w, http.StatusServiceUnavailable, report{Status: "unavailable", Checks: checks})
+	})
+}
+
+func writeReport(w http.ResponseWriter, code int, r report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(r)
+}
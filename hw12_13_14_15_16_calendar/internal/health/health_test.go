@@ -0,0 +1,41 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker(t *testing.T) {
+	t.Run("ready without failed checks", func(t *testing.T) {
+		checker := NewChecker()
+		checker.Add("db", func(context.Context) error { return nil })
+		mux := http.NewServeMux()
+		checker.Register(mux)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("not ready reports failed checks", func(t *testing.T) {
+		checker := NewChecker()
+		checker.Add("db", func(context.Context) error { return nil })
+		checker.Add("rabbitmq", func(context.Context) error { return errors.New("connection is closed") })
+		mux := http.NewServeMux()
+		checker.Register(mux)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		require.JSONEq(t, `{"status":"unavailable","checks":{"rabbitmq":"connection is closed"}}`, rec.Body.String())
+
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+}
@@ -0,0 +1,55 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+)
+
+type Logger interface {
+	Info(msg string)
+	Fatal(msg string, err error)
+}
+
+// Server exposes probes and metrics of binaries that have no API of their own.
+type Server struct {
+	server *http.Server
+	mux    *http.ServeMux
+	lg     Logger
+}
+
+func NewServer(cfg config.HTTPServer, checker *Checker, lg Logger) *Server {
+	mux := http.NewServeMux()
+	checker.Register(mux)
+	return &Server{
+		server: &http.Server{
+			Addr:              fmt.Sprintf("%s:%d", cfg.HTTPHost, cfg.HTTPPort),
+			Handler:           mux,
+			ReadHeaderTimeout: time.Second * 10,
+		},
+		mux: mux,
+		lg:  lg,
+	}
+}
+
+// Handle registers an additional handler next to the probes.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) Start() {
+	go func() {
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.lg.Fatal("failed to listen http "+s.server.Addr, err)
+		}
+	}()
+	s.lg.Info("probes and metrics are served on " + s.server.Addr)
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,79 @@
+// Package leader elects one of the replicas of a service to run the work that must not run twice.
+package leader
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var ErrNotLeader = errors.New("not the leader")
+
+var leading = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "calendar",
+	Subsystem: "leader",
+	Name:      "leading",
+	Help:      "Whether this replica leads the election, 1 or 0.",
+}, []string{"election"})
+
+// Campaigner is implemented by backends shared between replicas, they elect one of them.
+type Campaigner interface {
+	Campaign(ctx context.Context, name string, interval time.Duration, leading func(bool))
+}
+
+type Logger interface {
+	InfoWithParams(msg string, params map[string]string)
+}
+
+// Election tells whether this replica leads, it is the elector of the scheduler jobs.
+type Election struct {
+	name    string
+	lg      Logger
+	leading atomic.Bool
+}
+
+func New(name string, lg Logger) *Election {
+	e := &Election{name: name, lg: lg}
+	leading.WithLabelValues(name).Set(0)
+	return e
+}
+
+// Run campaigns through the backend until ctx is done. A backend that cannot be shared
+// between replicas does not campaign, this replica leads.
+func (e *Election) Run(ctx context.Context, backend any, interval time.Duration) {
+	c, ok := backend.(Campaigner)
+	if !ok {
+		e.set(true)
+		<-ctx.Done()
+		return
+	}
+	c.Campaign(ctx, e.name, interval, e.set)
+}
+
+// IsLeader returns ErrNotLeader unless this replica leads.
+func (e *Election) IsLeader(context.Context) error {
+	if !e.leading.Load() {
+		return ErrNotLeader
+	}
+	return nil
+}
+
+func (e *Election) set(leader bool) {
+	if e.leading.Swap(leader) == leader {
+		return
+	}
+	value := 0.0
+	if leader {
+		value = 1
+	}
+	leading.WithLabelValues(e.name).Set(value)
+	e.lg.InfoWithParams("leadership changed", map[string]string{
+		"election": e.name,
+		"leading":  strconv.FormatBool(leader),
+	})
+}
@@ -0,0 +1,51 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testLogger struct{}
+
+func (testLogger) InfoWithParams(string, map[string]string) {}
+
+type testCampaigner struct {
+	changes []bool
+}
+
+func (c testCampaigner) Campaign(_ context.Context, _ string, _ time.Duration, leading func(bool)) {
+	for _, leader := range c.changes {
+		leading(leader)
+	}
+}
+
+func TestElection(t *testing.T) {
+	t.Run("follows the campaign", func(t *testing.T) {
+		e := New("test", testLogger{})
+		require.ErrorIs(t, e.IsLeader(context.Background()), ErrNotLeader)
+
+		e.Run(context.Background(), testCampaigner{changes: []bool{true}}, time.Second)
+		require.NoError(t, e.IsLeader(context.Background()))
+
+		e.Run(context.Background(), testCampaigner{changes: []bool{true, false}}, time.Second)
+		require.ErrorIs(t, e.IsLeader(context.Background()), ErrNotLeader)
+	})
+
+	t.Run("leads without a shared backend", func(t *testing.T) {
+		e := New("test", testLogger{})
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			e.Run(ctx, struct{}{}, time.Second)
+		}()
+		require.Eventually(t, func() bool {
+			return e.IsLeader(context.Background()) == nil
+		}, time.Second, time.Millisecond)
+		cancel()
+		<-done
+	})
+}
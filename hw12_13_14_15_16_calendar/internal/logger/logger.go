@@ -1,59 +1,221 @@
 package logger
 
 import (
+	"context"
+	"io"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/mattn/go-isatty"
 	"github.com/rs/zerolog"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/requestid"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var lg = zerolog.New(os.Stdout).With().Timestamp().Logger()
+// Components with their own log level, see config.LogComponents.
+const (
+	ComponentServer    = "server"
+	ComponentService   = "service"
+	ComponentScheduler = "scheduler"
+	ComponentSender    = "sender"
+	ComponentStorage   = "storage"
+)
+
+const redactedValue = "[REDACTED]"
+
+// state is the configuration shared by all loggers, it is replaced as a whole by Configure.
+type state struct {
+	base       zerolog.Logger
+	sampled    zerolog.Logger
+	level      zerolog.Level
+	components map[string]zerolog.Level
+	redact     map[string]struct{}
+}
+
+var current atomic.Pointer[state]
+
+func init() {
+	// Levels are checked by Logger, the global level must not filter anything out.
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	base := newBase(os.Stdout, config.LogFormatJSON)
+	current.Store(&state{base: base, sampled: base, level: zerolog.InfoLevel})
+}
 
 type Logger struct {
-	Lg zerolog.Logger
+	component string
 }
 
 func New() *Logger {
-	return &Logger{Lg: lg}
+	return &Logger{}
+}
+
+// Component returns a logger that marks its lines with the component name
+// and uses the level configured for the component.
+func (l *Logger) Component(name string) *Logger {
+	return &Logger{component: name}
+}
+
+// Configure applies cfg to all loggers, it is safe to call while logging.
+func Configure(cfg config.LoggerConf) error {
+	return configure(cfg, os.Stdout)
+}
+
+func configure(cfg config.LoggerConf, w io.Writer) error {
+	level, err := zerolog.ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	components := make(map[string]zerolog.Level)
+	for name, value := range map[string]string{
+		ComponentServer:    cfg.Components.Server,
+		ComponentService:   cfg.Components.Service,
+		ComponentScheduler: cfg.Components.Scheduler,
+		ComponentSender:    cfg.Components.Sender,
+		ComponentStorage:   cfg.Components.Storage,
+	} {
+		if value == "" {
+			continue
+		}
+		if components[name], err = zerolog.ParseLevel(value); err != nil {
+			return err
+		}
+	}
+	redact := make(map[string]struct{}, len(cfg.Redact))
+	for _, key := range cfg.Redact {
+		redact[strings.ToLower(key)] = struct{}{}
+	}
+
+	base := newBase(w, cfg.Format)
+	sampled := base
+	if cfg.Sampling.Enabled {
+		sampled = base.Sample(&zerolog.BurstSampler{
+			Burst:       cfg.Sampling.Burst,
+			Period:      cfg.Sampling.Period,
+			NextSampler: &zerolog.BasicSampler{N: cfg.Sampling.Every},
+		})
+	}
+	current.Store(&state{base: base, sampled: sampled, level: level, components: components, redact: redact})
+	return nil
+}
+
+func newBase(w io.Writer, format string) zerolog.Logger {
+	if format == config.LogFormatConsole {
+		f, ok := w.(*os.File)
+		noColor := !ok || !isatty.IsTerminal(f.Fd())
+		w = zerolog.ConsoleWriter{Out: w, TimeFormat: time.RFC3339, NoColor: noColor}
+	}
+	return zerolog.New(w).With().Timestamp().Logger()
+}
+
+// event starts a line at level, it returns nil when the level is disabled,
+// zerolog treats a nil event as a no-op.
+func (l *Logger) event(level zerolog.Level, sampled bool) (*zerolog.Event, *state) {
+	st := current.Load()
+	enabled := st.level
+	if componentLevel, ok := st.components[l.component]; ok {
+		enabled = componentLevel
+	}
+	if level < enabled {
+		return nil, st
+	}
+	lg := st.base
+	if sampled {
+		lg = st.sampled
+	}
+	e := lg.WithLevel(level)
+	if l.component != "" {
+		e = e.Str("component", l.component)
+	}
+	return e, st
+}
+
+func (l *Logger) log(level zerolog.Level) (*zerolog.Event, *state) {
+	return l.event(level, false)
 }
 
 func (l *Logger) InfoWithParams(msg string, params map[string]string) {
-	lg := l.Lg.Info()
-	addParams(msg, params, lg)
+	e, st := l.log(zerolog.InfoLevel)
+	st.addParams(msg, params, e)
 }
 
 func (l *Logger) ErrorWithParams(msg string, params map[string]string, err error) {
-	lg := l.Lg.Error().Err(err)
-	addParams(msg, params, lg)
+	e, st := l.log(zerolog.ErrorLevel)
+	st.addParams(msg, params, e.Err(err))
 }
 
 func (l *Logger) DebugWithParams(msg string, params map[string]string) {
-	lg := l.Lg.Debug()
-	addParams(msg, params, lg)
+	e, st := l.log(zerolog.DebugLevel)
+	st.addParams(msg, params, e)
 }
 
-func (l *Logger) ErrorWithAny(msg string, name string, param any) {
-	l.Lg.Error().Any(name, param).Msg(msg)
-}
-
-func addParams(msg string, params map[string]string, lg *zerolog.Event) {
+func (st *state) addParams(msg string, params map[string]string, lg *zerolog.Event) {
+	if lg == nil {
+		return
+	}
 	for k, v := range params {
-		lg = lg.Any(k, v)
+		if _, ok := st.redact[strings.ToLower(k)]; ok {
+			v = redactedValue
+		}
+		lg = lg.Str(k, v)
 	}
 	lg.Msg(msg)
 }
 
 func (l *Logger) Error(msg string, err error) {
-	l.Lg.Error().Err(err).Msg(msg)
+	e, _ := l.log(zerolog.ErrorLevel)
+	e.Err(err).Msg(msg)
 }
 
 func (l *Logger) Fatal(msg string, err error) {
-	l.Lg.Fatal().Err(err).Msg(msg)
+	e, _ := l.log(zerolog.FatalLevel)
+	e.Err(err).Msg(msg)
+	os.Exit(1)
 }
 
 func (l *Logger) Info(msg string) {
-	l.Lg.Info().Msg(msg)
+	e, _ := l.log(zerolog.InfoLevel)
+	e.Msg(msg)
 }
 
 func (l *Logger) Debug(msg string) {
-	l.Lg.Info().Msg(msg)
+	e, _ := l.log(zerolog.DebugLevel)
+	e.Msg(msg)
+}
+
+// InfoCtx logs like InfoWithParams and adds the request and trace IDs of ctx.
+func (l *Logger) InfoCtx(ctx context.Context, msg string, params map[string]string) {
+	e, st := l.log(zerolog.InfoLevel)
+	st.addParams(msg, params, withContext(ctx, e))
+}
+
+func (l *Logger) DebugCtx(ctx context.Context, msg string, params map[string]string) {
+	e, st := l.log(zerolog.DebugLevel)
+	st.addParams(msg, params, withContext(ctx, e))
+}
+
+func (l *Logger) ErrorCtx(ctx context.Context, msg string, params map[string]string, err error) {
+	e, st := l.log(zerolog.ErrorLevel)
+	st.addParams(msg, params, withContext(ctx, e.Err(err)))
+}
+
+// AccessCtx logs a served request at info level, the lines are sampled when sampling is enabled.
+func (l *Logger) AccessCtx(ctx context.Context, msg string, params map[string]string) {
+	e, st := l.event(zerolog.InfoLevel, true)
+	st.addParams(msg, params, withContext(ctx, e))
+}
+
+func withContext(ctx context.Context, e *zerolog.Event) *zerolog.Event {
+	if e == nil {
+		return nil
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		e = e.Str("requestId", id)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		e = e.Str("traceId", sc.TraceID().String())
+	}
+	return e
 }
@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+)
+
+func configureBuffer(t *testing.T, cfg config.LoggerConf) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, configure(cfg, &buf))
+	t.Cleanup(func() {
+		require.NoError(t, Configure(config.LoggerConf{Level: "info", Format: config.LogFormatJSON}))
+	})
+	return &buf
+}
+
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]string {
+	t.Helper()
+	var result []map[string]string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]string{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		result = append(result, entry)
+	}
+	return result
+}
+
+func TestLevels(t *testing.T) {
+	buf := configureBuffer(t, config.LoggerConf{
+		Level:      "info",
+		Format:     config.LogFormatJSON,
+		Components: config.LogComponents{Service: "debug", Server: "error"},
+	})
+	lg := New()
+
+	lg.Debug("root debug")
+	lg.Info("root info")
+	lg.Component(ComponentService).Debug("service debug")
+	lg.Component(ComponentServer).Info("server info")
+	lg.Component(ComponentServer).Error("server error", nil)
+
+	entries := lines(t, buf)
+	require.Len(t, entries, 3)
+	require.Equal(t, "root info", entries[0]["message"])
+	require.Equal(t, "info", entries[0]["level"])
+	require.Equal(t, "service debug", entries[1]["message"])
+	require.Equal(t, "debug", entries[1]["level"])
+	require.Equal(t, ComponentService, entries[1]["component"])
+	require.Equal(t, "server error", entries[2]["message"])
+}
+
+func TestRedact(t *testing.T) {
+	buf := configureBuffer(t, config.LoggerConf{Level: "info", Format: config.LogFormatJSON, Redact: []string{"Description"}})
+
+	New().InfoWithParams("event", map[string]string{"title": "meeting", "description": "salary review"})
+
+	entries := lines(t, buf)
+	require.Len(t, entries, 1)
+	require.Equal(t, "meeting", entries[0]["title"])
+	require.Equal(t, redactedValue, entries[0]["description"])
+}
+
+func TestAccessSampling(t *testing.T) {
+	buf := configureBuffer(t, config.LoggerConf{
+		Level:    "info",
+		Format:   config.LogFormatJSON,
+		Sampling: config.LogSampling{Enabled: true, Burst: 2, Period: time.Hour, Every: 5},
+	})
+	lg := New()
+
+	for i := 0; i < 12; i++ {
+		lg.AccessCtx(t.Context(), "", map[string]string{"path": "/"})
+		lg.Info("not sampled")
+	}
+
+	var access, other int
+	for _, entry := range lines(t, buf) {
+		if entry["path"] != "" {
+			access++
+		} else {
+			other++
+		}
+	}
+	require.Equal(t, 12, other)
+	// Two lines of the burst, then every fifth of the remaining ten.
+	require.Equal(t, 4, access)
+}
+
+func TestConsoleFormat(t *testing.T) {
+	buf := configureBuffer(t, config.LoggerConf{Level: "info", Format: config.LogFormatConsole})
+
+	New().Component(ComponentSender).Info("started")
+
+	require.Contains(t, buf.String(), "INF")
+	require.Contains(t, buf.String(), "started")
+	require.Contains(t, buf.String(), "component=sender")
+	require.False(t, json.Valid(buf.Bytes()))
+}
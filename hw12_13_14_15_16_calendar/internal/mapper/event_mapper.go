@@ -1,14 +1,29 @@
 package mapper
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/grpc/pb"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// updateMaskFields accepts both the proto field names and their snake_case form,
+// which is what protojson produces when decoding a FieldMask from its JSON string.
+var updateMaskFields = map[string]storage.Field{
+	"title":             storage.FieldTitle,
+	"dateTime":          storage.FieldDateTime,
+	"date_time":         storage.FieldDateTime,
+	"eventDuration":     storage.FieldEventDuration,
+	"event_duration":    storage.FieldEventDuration,
+	"description":       storage.FieldDescription,
+	"notificationTime":  storage.FieldNotificationTime,
+	"notification_time": storage.FieldNotificationTime,
+}
+
 type EventMapper struct{}
 
 func (e EventMapper) CreateEventRequestToEvent(rq *pb.CreateEventRequest) *storage.Event {
@@ -82,3 +97,16 @@ func (e EventMapper) UpdateEventRequestToEvent(rq *pb.UpdateEventRequest) storag
 
 	return *storageEvent
 }
+
+func (e EventMapper) UpdateMaskToFields(mask *fieldmaskpb.FieldMask) ([]storage.Field, error) {
+	paths := mask.GetPaths()
+	fields := make([]storage.Field, 0, len(paths))
+	for _, path := range paths {
+		field, ok := updateMaskFields[path]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", storage.ErrUnknownField, path)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
@@ -0,0 +1,105 @@
+package reload
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+)
+
+type Logger interface {
+	InfoWithParams(msg string, params map[string]string)
+	ErrorWithParams(msg string, params map[string]string, err error)
+}
+
+// Reloader applies a freshly loaded config to a running binary.
+// Static keys are compared with the started config, so they are reported on every reload until a restart.
+type Reloader[T any] struct {
+	started T
+	current T
+	load    func() (T, error)
+	apply   func(T) error
+	dynamic []string
+	lg      Logger
+}
+
+// New creates a Reloader for a binary started with current config.
+// Only changes of keys starting with one of dynamic prefixes are applied,
+// the others are reported as requiring a restart.
+func New[T any](current T, load func() (T, error), apply func(T) error, lg Logger, dynamic ...string) *Reloader[T] {
+	return &Reloader[T]{
+		started: current,
+		current: current,
+		load:    load,
+		apply:   apply,
+		dynamic: dynamic,
+		lg:      lg,
+	}
+}
+
+// WatchSIGHUP reloads the config on every SIGHUP until ctx is done.
+func (r *Reloader[T]) WatchSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			_ = r.Reload()
+		}
+	}
+}
+
+// Reload loads the config and applies it. An invalid config is refused and the running one is kept.
+func (r *Reloader[T]) Reload() error {
+	next, err := r.load()
+	if err != nil {
+		r.lg.ErrorWithParams("config reload refused", nil, err)
+		return err
+	}
+	var dynamic, static []config.Change
+	for _, c := range config.Diff(r.current, next) {
+		if r.isDynamic(c.Key) {
+			dynamic = append(dynamic, c)
+		}
+	}
+	for _, c := range config.Diff(r.started, next) {
+		if !r.isDynamic(c.Key) {
+			static = append(static, c)
+		}
+	}
+	if len(dynamic) == 0 && len(static) == 0 {
+		r.lg.InfoWithParams("config reloaded, nothing changed", nil)
+		return nil
+	}
+	for _, c := range dynamic {
+		r.lg.InfoWithParams("config key changed", map[string]string{"key": c.Key, "old": c.Old, "new": c.New})
+	}
+	for _, c := range static {
+		r.lg.InfoWithParams("config key changed, restart to apply",
+			map[string]string{"key": c.Key, "old": c.Old, "new": c.New})
+	}
+	if len(dynamic) == 0 {
+		return nil
+	}
+	if err := r.apply(next); err != nil {
+		r.lg.ErrorWithParams("apply reloaded config", nil, err)
+		return err
+	}
+	r.current = next
+	return nil
+}
+
+func (r *Reloader[T]) isDynamic(key string) bool {
+	for _, prefix := range r.dynamic {
+		if key == prefix || strings.HasPrefix(key, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package reload
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type settings struct {
+	Level    string `yaml:"level"`
+	Password string `yaml:"password"`
+	DB       struct {
+		Host string `yaml:"host"`
+	} `yaml:"db"`
+}
+
+type logEntry struct {
+	msg    string
+	params map[string]string
+}
+
+type testLogger struct {
+	entries []logEntry
+}
+
+func (l *testLogger) InfoWithParams(msg string, params map[string]string) {
+	l.entries = append(l.entries, logEntry{msg: msg, params: params})
+}
+
+func (l *testLogger) ErrorWithParams(msg string, params map[string]string, _ error) {
+	l.entries = append(l.entries, logEntry{msg: msg, params: params})
+}
+
+func TestReload(t *testing.T) {
+	var errInvalid = errors.New("invalid")
+	current := settings{Level: "info", Password: "old"}
+
+	var next settings
+	var loadErr error
+	var applied []settings
+	lg := &testLogger{}
+	r := New(current,
+		func() (settings, error) { return next, loadErr },
+		func(s settings) error {
+			applied = append(applied, s)
+			return nil
+		},
+		lg, "level",
+	)
+
+	t.Run("applies changes and logs diff", func(t *testing.T) {
+		next = current
+		next.Level = "debug"
+		next.Password = "new"
+		next.DB.Host = "db"
+
+		require.NoError(t, r.Reload())
+		require.Equal(t, []settings{next}, applied)
+		require.Equal(t, []logEntry{
+			{msg: "config key changed", params: map[string]string{"key": "level", "old": "info", "new": "debug"}},
+			{
+				msg:    "config key changed, restart to apply",
+				params: map[string]string{"key": "password", "old": "***", "new": "***"},
+			},
+			{
+				msg:    "config key changed, restart to apply",
+				params: map[string]string{"key": "db.host", "old": "", "new": "db"},
+			},
+		}, lg.entries)
+	})
+
+	t.Run("refuses invalid config", func(t *testing.T) {
+		applied = nil
+		loadErr = errInvalid
+		next.Level = "trace"
+
+		require.ErrorIs(t, r.Reload(), errInvalid)
+		require.Empty(t, applied)
+	})
+
+	t.Run("static keys are reported until restart", func(t *testing.T) {
+		loadErr = nil
+		next.Level = "debug"
+
+		for i := 0; i < 2; i++ {
+			lg.entries = nil
+			require.NoError(t, r.Reload())
+			require.Empty(t, applied, "only static keys differ")
+			require.Equal(t, []logEntry{
+				{
+					msg:    "config key changed, restart to apply",
+					params: map[string]string{"key": "password", "old": "***", "new": "***"},
+				},
+				{
+					msg:    "config key changed, restart to apply",
+					params: map[string]string{"key": "db.host", "old": "", "new": "db"},
+				},
+			}, lg.entries)
+		}
+	})
+
+	t.Run("nothing changed", func(t *testing.T) {
+		next = current
+		next.Level = "debug"
+
+		require.NoError(t, r.Reload())
+		require.Empty(t, applied)
+		require.Equal(t, "config reloaded, nothing changed", lg.entries[len(lg.entries)-1].msg)
+	})
+}
@@ -0,0 +1,42 @@
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Header carries the request ID in HTTP requests and responses, grpc metadata and AMQP messages.
+const Header = "x-request-id"
+
+const maxLength = 128
+
+type ctxKey struct{}
+
+func New() string {
+	return uuid.NewString()
+}
+
+// Accept returns id when it can be used as a request ID, otherwise a new ID.
+// Client provided IDs end up in logs, so they are limited to a short printable string.
+func Accept(id string) string {
+	if id == "" || len(id) > maxLength {
+		return New()
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return New()
+		}
+	}
+	return id
+}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID of ctx or an empty string.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
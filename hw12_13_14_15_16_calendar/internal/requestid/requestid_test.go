@@ -0,0 +1,33 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccept(t *testing.T) {
+	require.Equal(t, "abc-123", Accept("abc-123"))
+
+	for name, id := range map[string]string{
+		"empty":       "",
+		"too long":    strings.Repeat("a", maxLength+1),
+		"with spaces": "abc 123",
+		"with breaks": "abc\n{\"level\":\"error\"}",
+		"not ascii":   "идентификатор",
+	} {
+		t.Run(name, func(t *testing.T) {
+			generated := Accept(id)
+			require.NotEqual(t, id, generated)
+			require.NoError(t, uuid.Validate(generated))
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	require.Empty(t, FromContext(context.Background()))
+	require.Equal(t, "abc", FromContext(NewContext(context.Background(), "abc")))
+}
@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+)
+
+// ArchivedEvent is a line of an archive file.
+type ArchivedEvent struct {
+	ID                 string     `json:"id"`
+	Title              *string    `json:"title,omitempty"`
+	DateTime           *time.Time `json:"dateTime,omitempty"`
+	EventDuration      *int64     `json:"eventDuration,omitempty"`
+	Description        *string    `json:"description,omitempty"`
+	UserID             string     `json:"userId,omitempty"`
+	NotificationTime   *time.Time `json:"notificationTime,omitempty"`
+	NotificationStatus *string    `json:"notificationStatus,omitempty"`
+}
+
+// archive appends the events of a cleanup run to a file of JSON lines. Every batch is a separate
+// gzip member that is synced before the events are deleted, so a crash loses no archived event
+// and the file stays readable by gzip. Events of a batch archived before a crash may be archived twice.
+type archive struct {
+	f *os.File
+}
+
+func archivePath(dir string, now time.Time) string {
+	return filepath.Join(dir, "events-"+now.UTC().Format("20060102T150405Z")+".jsonl.gz")
+}
+
+func openArchive(dir string, now time.Time) (*archive, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(archivePath(dir, now), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &archive{f: f}, nil
+}
+
+func (a *archive) write(events []storage.Event) error {
+	gz := gzip.NewWriter(a.f)
+	enc := json.NewEncoder(gz)
+	for _, e := range events {
+		if err := enc.Encode(archivedEvent(e)); err != nil {
+			return errors.Join(err, gz.Close())
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write archive : %w", err)
+	}
+	return a.f.Sync()
+}
+
+func (a *archive) close() error {
+	return a.f.Close()
+}
+
+func archivedEvent(e storage.Event) ArchivedEvent {
+	archived := ArchivedEvent{
+		ID:                 e.ID.String(),
+		Title:              e.Title,
+		DateTime:           e.DateTime,
+		Description:        e.Description,
+		NotificationTime:   e.NotificationTime,
+		NotificationStatus: e.NotificationStatus,
+	}
+	if e.EventDuration != nil {
+		archived.EventDuration = ptr(int64(e.EventDuration.Seconds()))
+	}
+	if e.UserID != nil {
+		archived.UserID = e.UserID.String()
+	}
+	return archived
+}
@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/storagetest"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) DebugCtx(context.Context, string, map[string]string) {}
+
+func (l testLogger) InfoCtx(context.Context, string, map[string]string) {}
+
+func (l testLogger) ErrorCtx(_ context.Context, msg string, _ map[string]string, err error) {
+	l.t.Errorf("%s: %s", msg, err)
+}
+
+func newOldEvents(t *testing.T, s storage.Storage, n int) []storage.Event {
+	t.Helper()
+	events := make([]storage.Event, 0, n)
+	for i := 0; i < n; i++ {
+		e := storagetest.NewEvent()
+		e.DateTime = ptr(time.Now().AddDate(-2, 0, -i))
+		require.NoError(t, s.Create(context.Background(), e))
+		events = append(events, e)
+	}
+	return events
+}
+
+func readArchive(t *testing.T, dir string) []ArchivedEvent {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "events-*.jsonl.gz"))
+	require.NoError(t, err)
+	require.Len(t, paths, 1)
+	f, err := os.Open(paths[0])
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	var events []ArchivedEvent
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var e ArchivedEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		events = append(events, e)
+	}
+	require.NoError(t, scanner.Err())
+	return events
+}
+
+func TestDeleteOldEvents(t *testing.T) {
+	ctx := context.Background()
+	settings := Settings{Retention: 365 * 24 * time.Hour, DeleteBatchSize: 2}
+
+	t.Run("deletes in batches and archives", func(t *testing.T) {
+		s := memorystorage.New()
+		old := newOldEvents(t, s, 5)
+		recent := storagetest.NewEvent()
+		require.NoError(t, s.Create(ctx, recent))
+
+		settings := settings
+		settings.ArchiveDir = t.TempDir()
+		require.NoError(t, NewNotificationScheduler(s, nil, testLogger{t}, "", settings).deleteOldEvents(ctx))
+
+		count, err := s.CountOlderThan(ctx, time.Now())
+		require.NoError(t, err)
+		require.Zero(t, count)
+		_, err = s.GetByID(ctx, recent.ID)
+		require.NoError(t, err)
+
+		archived := readArchive(t, settings.ArchiveDir)
+		require.Len(t, archived, len(old))
+		ids := make([]string, 0, len(archived))
+		for _, e := range archived {
+			ids = append(ids, e.ID)
+		}
+		for _, e := range old {
+			require.Contains(t, ids, e.ID.String())
+		}
+		require.Equal(t, int64(3600), *archived[0].EventDuration)
+	})
+
+	t.Run("dry run keeps events", func(t *testing.T) {
+		s := memorystorage.New()
+		old := newOldEvents(t, s, 3)
+
+		settings := settings
+		settings.DryRun = true
+		settings.ArchiveDir = t.TempDir()
+		require.NoError(t, NewNotificationScheduler(s, nil, testLogger{t}, "", settings).deleteOldEvents(ctx))
+
+		for _, e := range old {
+			_, err := s.GetByID(ctx, e.ID)
+			require.NoError(t, err)
+		}
+		entries, err := os.ReadDir(settings.ArchiveDir)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+}
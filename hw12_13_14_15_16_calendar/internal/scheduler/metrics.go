@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	sendEventsJob      = "send_events"
+	deleteOldEventsJob = "delete_old_events"
+)
+
+var (
+	eventsFound = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "scheduler",
+		Name:      "events_found_total",
+		Help:      "Number of events found for notification.",
+	})
+
+	notificationsPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "scheduler",
+		Name:      "notifications_published_total",
+		Help:      "Number of notifications published to the queue.",
+	})
+
+	notificationsFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "scheduler",
+		Name:      "notifications_failed_total",
+		Help:      "Number of notifications that could not be published or marked as sent.",
+	})
+
+	notificationsExpired = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "scheduler",
+		Name:      "notifications_expired_total",
+		Help:      "Number of pending notifications not published within the grace window.",
+	})
+
+	notificationsReleased = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "scheduler",
+		Name:      "notifications_released_total",
+		Help:      "Number of claimed notifications not published within the claim timeout.",
+	})
+
+	notificationLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "calendar",
+		Subsystem: "scheduler",
+		Name:      "notification_lag_seconds",
+		Help:      "Time between the notification time of an event and the publication of its notification.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+	})
+
+	eventsDeleted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "scheduler",
+		Name:      "events_deleted_total",
+		Help:      "Number of old events deleted.",
+	})
+
+	eventsArchived = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "scheduler",
+		Name:      "events_archived_total",
+		Help:      "Number of old events written to the archive before deletion.",
+	})
+
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "calendar",
+		Subsystem: "scheduler",
+		Name:      "job_duration_seconds",
+		Help:      "Duration of scheduler job runs.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"job"})
+)
@@ -3,18 +3,34 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/requestid"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	statusPending     = "PENDING"
+	statusPendingSent = "PENDING_SENT"
+)
+
+var errNotificationsFailed = errors.New("notifications failed")
+
+var tracer = otel.Tracer("github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/scheduler")
+
 type NotificationSchedulerLogger interface {
-	Error(msg string, err error)
-	Debug(msg string)
-	ErrorWithParams(msg string, params map[string]string, err error)
+	DebugCtx(ctx context.Context, msg string, params map[string]string)
+	InfoCtx(ctx context.Context, msg string, params map[string]string)
+	ErrorCtx(ctx context.Context, msg string, params map[string]string, err error)
 }
 
 type Scheduler interface {
@@ -22,14 +38,18 @@ type Scheduler interface {
 }
 
 type SenderService interface {
-	Send(queueName string, message []byte) error
+	Send(ctx context.Context, queueName string, message []byte) error
 }
 
 type Storage interface {
-	FindByCurrentTimeByMinutesAndPendingStatus() ([]storage.Event, error)
-	Update(ctx context.Context, newEvent storage.Event) error
-	FindByDateTimeMoreOrEqual(dateTime time.Time) ([]storage.Event, error)
-	Delete(ctx context.Context, eventID uuid.UUID) error
+	FindDueNotifications(ctx context.Context, from, to time.Time) ([]storage.Event, error)
+	ExpireNotifications(ctx context.Context, dateTime time.Time) ([]uuid.UUID, error)
+	ReleaseClaims(ctx context.Context, claimedBefore time.Time) ([]uuid.UUID, error)
+	Update(ctx context.Context, newEvent storage.Event, fields ...storage.Field) error
+	FindOlderThan(ctx context.Context, dateTime time.Time, limit int) ([]storage.Event, error)
+	CountOlderThan(ctx context.Context, dateTime time.Time) (int, error)
+	DeleteByIDs(ctx context.Context, eventIDs []uuid.UUID) (int, error)
+	WithTx(ctx context.Context, fn func(tx storage.Repository) error) error
 }
 
 type NotificationScheduler struct {
@@ -37,115 +57,301 @@ type NotificationScheduler struct {
 	sender    SenderService
 	logger    NotificationSchedulerLogger
 	queueName string
+	settings  *atomic.Pointer[Settings]
+}
+
+// Settings can be changed while the scheduler runs.
+type Settings struct {
+	// GraceWindow is how late a notification is still published, older ones expire.
+	GraceWindow time.Duration
+	// ClaimTimeout is how long a claimed notification may stay unpublished before it is claimed again,
+	// it outlasts a run of the job. Zero keeps the claims.
+	ClaimTimeout time.Duration
+	// Retention is the age after which events are deleted.
+	Retention time.Duration
+	// DeleteBatchSize is the number of events deleted by one statement.
+	DeleteBatchSize int
+	// DryRun only reports the number of events that would be deleted.
+	DryRun bool
+	// ArchiveDir receives the events before they are deleted, nothing is archived when it is empty.
+	ArchiveDir string
 }
 
 func NewNotificationScheduler(
-	storage Storage, sender SenderService, logger NotificationSchedulerLogger, queueName string,
+	storage Storage, sender SenderService, logger NotificationSchedulerLogger, queueName string, settings Settings,
 ) NotificationScheduler {
 	notificationScheduler := NotificationScheduler{
 		storage:   storage,
 		sender:    sender,
 		logger:    logger,
 		queueName: queueName,
+		settings:  &atomic.Pointer[Settings]{},
 	}
+	notificationScheduler.settings.Store(&settings)
 	return notificationScheduler
 }
 
+// Apply switches to the new settings, the next job runs use them.
+func (n NotificationScheduler) Apply(settings Settings) {
+	n.settings.Store(&settings)
+}
+
+// Register adds the notification jobs to the scheduler, they run once they are defined.
+func (n NotificationScheduler) Register(s *CalendarScheduler) {
+	s.Register(sendEventsJob, n.sendEvents)
+	s.Register(deleteOldEventsJob, n.deleteOldEvents)
+}
+
+// Notification is published when the reminder of an event is due. DateTime is the time of the reminder,
+// StartsAt the start of the event.
 type Notification struct {
 	ID       string    `json:"id"`
 	Title    string    `json:"title"`
 	DateTime time.Time `json:"dateTime"`
+	StartsAt time.Time `json:"startsAt"`
 	UserID   string    `json:"userId"`
 }
 
-func (n NotificationScheduler) GetJobs() []Job {
-	return []Job{
-		{
-			Function:       n.sendEvents(),
-			FunctionParams: nil,
-			Cron:           "* * * * *",
-		},
-		{
-			Function:       n.deleteOldEvents(),
-			FunctionParams: nil,
-			Cron:           "0 0 * * *",
-		},
+// sendEvents publishes the due notifications, it fails when some of them were not published.
+func (n NotificationScheduler) sendEvents(ctx context.Context) error {
+	defer observeDuration(sendEventsJob, time.Now())
+	ctx, span := startJobSpan(ctx, sendEventsJob)
+	defer span.End()
+
+	// Every run catches up on the notifications missed during downtime or by slow runs.
+	now := time.Now()
+	settings := n.settings.Load()
+	if settings.ClaimTimeout > 0 {
+		n.releaseClaims(ctx, now.Add(-settings.ClaimTimeout))
+	}
+	from := now.Add(-settings.GraceWindow)
+	n.expire(ctx, from)
+	events, err := n.storage.FindDueNotifications(ctx, from, now)
+	if err != nil {
+		n.logger.ErrorCtx(ctx, "get events for notification", nil, err)
+		return err
 	}
+	if len(events) == 0 {
+		n.logger.DebugCtx(ctx, "found 0 events to sending", nil)
+		return nil
+	}
+	eventsFound.Add(float64(len(events)))
+	span.SetAttributes(attribute.Int("events.found", len(events)))
+	wg := sync.WaitGroup{}
+	var failed atomic.Int64
+	for _, e := range events {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claimed, err := n.claim(ctx, e)
+			if err != nil {
+				failed.Add(1)
+				notificationsFailed.Inc()
+				n.logger.ErrorCtx(ctx,
+					"update event status", map[string]string{"eventId": e.ID.String()}, err,
+				)
+				return
+			}
+			if !claimed {
+				return
+			}
+			if err := n.handleEventForNotification(ctx, e); err != nil {
+				failed.Add(1)
+				notificationsFailed.Inc()
+				n.release(ctx, e)
+				return
+			}
+			n.published(ctx, e)
+			notificationsPublished.Inc()
+			notificationLag.Observe(time.Since(*e.NotificationTime).Seconds())
+		}()
+	}
+	wg.Wait()
+	n.logger.DebugCtx(ctx, "finish processed events", map[string]string{"count": strconv.Itoa(len(events))})
+	if failed.Load() > 0 {
+		return fmt.Errorf("%w: %d of %d", errNotificationsFailed, failed.Load(), len(events))
+	}
+	return nil
 }
 
-func (n NotificationScheduler) sendEvents() func() {
-	return func() {
-		events, err := n.storage.FindByCurrentTimeByMinutesAndPendingStatus()
+// expire marks the pending notifications that are due before from as expired, they are not published.
+func (n NotificationScheduler) expire(ctx context.Context, from time.Time) {
+	expired, err := n.storage.ExpireNotifications(ctx, from)
+	if err != nil {
+		n.logger.ErrorCtx(ctx, "expire missed notifications", nil, err)
+		return
+	}
+	if len(expired) == 0 {
+		return
+	}
+	notificationsExpired.Add(float64(len(expired)))
+	n.logger.InfoCtx(ctx, "expired missed notifications", map[string]string{
+		"count":  strconv.Itoa(len(expired)),
+		"before": from.Format(time.RFC3339),
+	})
+}
+
+// releaseClaims returns the notifications claimed by a run that stopped before publishing them, for example
+// when the scheduler was killed. They are published by this run or expired like missed ones.
+func (n NotificationScheduler) releaseClaims(ctx context.Context, claimedBefore time.Time) {
+	released, err := n.storage.ReleaseClaims(ctx, claimedBefore)
+	if err != nil {
+		n.logger.ErrorCtx(ctx, "release stale claims", nil, err)
+		return
+	}
+	if len(released) == 0 {
+		return
+	}
+	notificationsReleased.Add(float64(len(released)))
+	n.logger.InfoCtx(ctx, "released stale claims", map[string]string{
+		"count":         strconv.Itoa(len(released)),
+		"claimedBefore": claimedBefore.Format(time.RFC3339),
+	})
+}
+
+// claim marks the event as sent with the claim time before the notification is published, so a concurrent
+// run does not publish it again. It reports false when the event was changed or deleted since the query.
+func (n NotificationScheduler) claim(ctx context.Context, e storage.Event) (bool, error) {
+	var claimed bool
+	err := n.storage.WithTx(ctx, func(tx storage.Repository) error {
+		claimed = false
+		current, err := tx.GetByID(ctx, e.ID)
+		if errors.Is(err, storage.ErrEventNotFoundErr) {
+			return nil
+		}
 		if err != nil {
-			n.logger.Error("get events for notification", err)
+			return err
 		}
-		if len(events) == 0 {
-			n.logger.Debug("found 0 events to sending")
-			return
+		if !hasStatus(current, statusPending) || current.NotificationTime == nil ||
+			!current.NotificationTime.Equal(*e.NotificationTime) {
+			return nil
 		}
-		wg := sync.WaitGroup{}
-		for _, e := range events {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				n.handleEventForNotification(e)
-				status := "PENDING_SENT"
-				err := n.storage.Update(context.Background(), storage.Event{
-					ID:                 e.ID,
-					NotificationStatus: &status,
-				})
-				if err != nil {
-					n.logger.ErrorWithParams(
-						"update event status", map[string]string{"eventId": e.ID.String()}, err,
-					)
-				}
-			}()
+		claimed = true
+		return tx.Update(ctx, storage.Event{
+			ID:                    e.ID,
+			NotificationStatus:    ptr(statusPendingSent),
+			NotificationClaimedAt: ptr(time.Now()),
+		})
+	})
+	return claimed && err == nil, err
+}
+
+// published clears the claim of a published notification, so it is not released and published again.
+// When this fails the notification is published again after the claim timeout.
+func (n NotificationScheduler) published(ctx context.Context, e storage.Event) {
+	err := n.storage.Update(ctx, storage.Event{ID: e.ID}, storage.FieldNotificationClaimedAt)
+	if err != nil && !errors.Is(err, storage.ErrEventNotFoundErr) {
+		n.logger.ErrorCtx(ctx, "clear event claim", map[string]string{"eventId": e.ID.String()}, err)
+	}
+}
+
+// release returns a claimed event to pending when its notification was not published, the claim is cleared
+// with the status.
+func (n NotificationScheduler) release(ctx context.Context, e storage.Event) {
+	err := n.storage.WithTx(ctx, func(tx storage.Repository) error {
+		current, err := tx.GetByID(ctx, e.ID)
+		if errors.Is(err, storage.ErrEventNotFoundErr) {
+			return nil
+		}
+		if err != nil || !hasStatus(current, statusPendingSent) {
+			return err
+		}
+		return tx.Update(ctx, storage.Event{ID: e.ID, NotificationStatus: ptr(statusPending)})
+	})
+	if err != nil {
+		n.logger.ErrorCtx(ctx, "release event status", map[string]string{"eventId": e.ID.String()}, err)
+	}
+}
+
+func hasStatus(e storage.Event, status string) bool {
+	return e.NotificationStatus != nil && *e.NotificationStatus == status
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func (n NotificationScheduler) deleteOldEvents(ctx context.Context) error {
+	defer observeDuration(deleteOldEventsJob, time.Now())
+	ctx, span := startJobSpan(ctx, deleteOldEventsJob)
+	defer span.End()
+
+	settings := n.settings.Load()
+	before := time.Now().Add(-settings.Retention)
+	if settings.DryRun {
+		count, err := n.storage.CountOlderThan(ctx, before)
+		if err != nil {
+			n.logger.ErrorCtx(ctx, "count old events", nil, err)
+			return err
 		}
-		wg.Wait()
-		n.logger.Debug(fmt.Sprintf("finish processed %d events", len(events)))
+		span.SetAttributes(attribute.Int("events.old", count))
+		n.logger.InfoCtx(ctx, "dry run, old events are kept", map[string]string{
+			"count":  strconv.Itoa(count),
+			"before": before.Format(time.RFC3339),
+		})
+		return nil
 	}
+
+	deleted, err := n.deleteOlderThan(ctx, before, settings)
+	span.SetAttributes(attribute.Int("events.deleted", deleted))
+	if err != nil {
+		n.logger.ErrorCtx(ctx, "delete old events", map[string]string{"deleted": strconv.Itoa(deleted)}, err)
+		return err
+	}
+	n.logger.DebugCtx(ctx, "deleted events", map[string]string{"count": strconv.Itoa(deleted)})
+	return nil
 }
 
-func (n NotificationScheduler) deleteOldEvents() func() {
-	return func() {
-		dateTime := time.Now().Add(-time.Hour * 24 * 365)
-		events, err := n.storage.FindByDateTimeMoreOrEqual(dateTime)
+// deleteOlderThan deletes the events in batches, the oldest first. The events of a batch are archived
+// before they are deleted, a failed archive keeps them for the next run.
+func (n NotificationScheduler) deleteOlderThan(
+	ctx context.Context, before time.Time, settings *Settings,
+) (deleted int, err error) {
+	var a *archive
+	if settings.ArchiveDir != "" {
+		a, err = openArchive(settings.ArchiveDir, time.Now())
 		if err != nil {
-			n.logger.Error("get old events", err)
-			return
+			return 0, fmt.Errorf("failed to open archive : %w", err)
+		}
+		defer func() {
+			err = errors.Join(err, a.close())
+		}()
+	}
+	for {
+		events, err := n.storage.FindOlderThan(ctx, before, settings.DeleteBatchSize)
+		if err != nil || len(events) == 0 {
+			return deleted, err
+		}
+		if a != nil {
+			if err := a.write(events); err != nil {
+				return deleted, err
+			}
+			eventsArchived.Add(float64(len(events)))
 		}
-		wg := sync.WaitGroup{}
+		ids := make([]uuid.UUID, 0, len(events))
 		for _, e := range events {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				err := n.storage.Delete(context.Background(), e.ID)
-				if err != nil {
-					n.logger.ErrorWithParams(
-						"delete old event",
-						map[string]string{
-							"id":       e.ID.String(),
-							"dateTime": e.NotificationTime.String(),
-						},
-						err,
-					)
-				}
-			}()
+			ids = append(ids, e.ID)
+		}
+		count, err := n.storage.DeleteByIDs(ctx, ids)
+		deleted += count
+		eventsDeleted.Add(float64(count))
+		// A short batch was the last one, nothing deleted means the rest is deleted by someone else.
+		if err != nil || len(events) < settings.DeleteBatchSize || count == 0 {
+			return deleted, err
 		}
-		wg.Wait()
-		n.logger.Debug(fmt.Sprintf("deleted %d events", len(events)))
 	}
 }
 
-func (n NotificationScheduler) handleEventForNotification(e storage.Event) {
+func (n NotificationScheduler) handleEventForNotification(ctx context.Context, e storage.Event) error {
 	notification, err := json.Marshal(Notification{
 		ID:       e.ID.String(),
 		Title:    *e.Title,
 		DateTime: *e.NotificationTime,
+		StartsAt: *e.DateTime,
 		UserID:   e.UserID.String(),
 	})
 	if err != nil {
-		n.logger.ErrorWithParams(
+		n.logger.ErrorCtx(ctx,
 			"marshal event to notification",
 			map[string]string{
 				"id":       e.ID.String(),
@@ -155,11 +361,11 @@ func (n NotificationScheduler) handleEventForNotification(e storage.Event) {
 			},
 			err,
 		)
-		return
+		return err
 	}
-	err = n.sender.Send(n.queueName, notification)
+	err = n.sender.Send(ctx, n.queueName, notification)
 	if err != nil {
-		n.logger.ErrorWithParams(
+		n.logger.ErrorCtx(ctx,
 			"send event to queue",
 			map[string]string{
 				"queueName":    n.queueName,
@@ -168,4 +374,15 @@ func (n NotificationScheduler) handleEventForNotification(e storage.Event) {
 			err,
 		)
 	}
+	return err
+}
+
+// startJobSpan starts a job run, its request ID is passed with published notifications to the sender.
+func startJobSpan(ctx context.Context, job string) (context.Context, trace.Span) {
+	ctx = requestid.NewContext(ctx, requestid.New())
+	return tracer.Start(ctx, "scheduler."+job, trace.WithNewRoot())
+}
+
+func observeDuration(job string, start time.Time) {
+	jobDuration.WithLabelValues(job).Observe(time.Since(start).Seconds())
 }
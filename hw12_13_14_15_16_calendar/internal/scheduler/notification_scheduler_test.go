@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/storagetest"
+)
+
+type testSender struct {
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func (s *testSender) Send(_ context.Context, _ string, message []byte) error {
+	var n Notification
+	if err := json.Unmarshal(message, &n); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, n)
+	return nil
+}
+
+func TestSendEventsCatchesUp(t *testing.T) {
+	ctx := context.Background()
+	s := memorystorage.New()
+	newEvent := func(notificationTime time.Time) storage.Event {
+		e := storagetest.NewEvent()
+		e.NotificationTime = &notificationTime
+		require.NoError(t, s.Create(ctx, e))
+		return e
+	}
+	missed := newEvent(time.Now().Add(-5 * time.Minute))
+	expired := newEvent(time.Now().Add(-time.Hour))
+	upcoming := newEvent(time.Now().Add(time.Hour))
+
+	sender := &testSender{}
+	settings := Settings{GraceWindow: 15 * time.Minute}
+	require.NoError(t, NewNotificationScheduler(s, sender, testLogger{t}, "", settings).sendEvents(ctx))
+
+	require.Len(t, sender.sent, 1)
+	require.Equal(t, missed.ID.String(), sender.sent[0].ID)
+	require.True(t, missed.NotificationTime.Equal(sender.sent[0].DateTime))
+	require.True(t, missed.DateTime.Equal(sender.sent[0].StartsAt), "the notification carries the start of the event")
+	status := func(e storage.Event) string {
+		got, err := s.GetByID(ctx, e.ID)
+		require.NoError(t, err)
+		return *got.NotificationStatus
+	}
+	require.Equal(t, statusPendingSent, status(missed))
+	require.Equal(t, "EXPIRED", status(expired))
+	require.Equal(t, statusPending, status(upcoming))
+}
+
+func TestSendEventsReleasesStaleClaims(t *testing.T) {
+	ctx := context.Background()
+	s := memorystorage.New()
+	claimed := func(claimedAt *time.Time) storage.Event {
+		e := storagetest.NewEvent()
+		e.NotificationTime = ptr(time.Now().Add(-10 * time.Minute))
+		require.NoError(t, s.Create(ctx, e))
+		require.NoError(t, s.Update(ctx, storage.Event{
+			ID:                    e.ID,
+			NotificationStatus:    ptr(statusPendingSent),
+			NotificationClaimedAt: claimedAt,
+		}, storage.FieldNotificationStatus, storage.FieldNotificationClaimedAt))
+		return e
+	}
+	// The scheduler was killed between the claim and the publication.
+	stale := claimed(ptr(time.Now().Add(-time.Hour)))
+	running := claimed(ptr(time.Now()))
+	published := claimed(nil)
+
+	sender := &testSender{}
+	settings := Settings{GraceWindow: 15 * time.Minute, ClaimTimeout: 5 * time.Minute}
+	require.NoError(t, NewNotificationScheduler(s, sender, testLogger{t}, "", settings).sendEvents(ctx))
+
+	require.Len(t, sender.sent, 1)
+	require.Equal(t, stale.ID.String(), sender.sent[0].ID)
+	got, err := s.GetByID(ctx, stale.ID)
+	require.NoError(t, err)
+	require.Equal(t, statusPendingSent, *got.NotificationStatus)
+	require.Nil(t, got.NotificationClaimedAt, "the claim is cleared once the notification is published")
+	for _, e := range []storage.Event{running, published} {
+		got, err := s.GetByID(ctx, e.ID)
+		require.NoError(t, err)
+		require.Equal(t, statusPendingSent, *got.NotificationStatus)
+	}
+}
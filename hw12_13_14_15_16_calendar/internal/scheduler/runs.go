@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrJobPaused       = errors.New("job is paused")
+	ErrJobNotScheduled = errors.New("job is not scheduled")
+	ErrNotLeader       = errors.New("replica is not the leader")
+	ErrNotStarted      = errors.New("scheduler is not started")
+)
+
+// Run is a finished execution of a job.
+type Run struct {
+	Job             string    `json:"job"`
+	Started         time.Time `json:"started"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// JobStatus is the state of a registered job on this replica. Schedule is empty
+// when the job is not enabled in the config, NextRun is unknown until the scheduler starts.
+type JobStatus struct {
+	Name     string     `json:"name"`
+	Schedule string     `json:"schedule,omitempty"`
+	Paused   bool       `json:"paused"`
+	Running  bool       `json:"running"`
+	NextRun  *time.Time `json:"nextRun,omitempty"`
+	LastRun  *Run       `json:"lastRun,omitempty"`
+}
+
+// jobState outlives changes of the job definition.
+type jobState struct {
+	paused  atomic.Bool
+	running atomic.Int32
+}
+
+// Jobs returns the status of the registered jobs ordered by name.
+func (s *CalendarScheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]JobStatus, 0, len(s.registry))
+	for name := range s.registry {
+		jobs = append(jobs, s.status(name))
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// Job returns the status of a registered job.
+func (s *CalendarScheduler) Job(name string) (JobStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.registry[name]; !ok {
+		return JobStatus{}, fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+	return s.status(name), nil
+}
+
+func (s *CalendarScheduler) status(name string) JobStatus {
+	state := s.states[name]
+	status := JobStatus{
+		Name:    name,
+		Paused:  state.paused.Load(),
+		Running: state.running.Load() > 0,
+	}
+	if job, ok := s.jobs[name]; ok {
+		status.Schedule = job.schedule()
+		if next, err := job.job.NextRun(); err == nil && !next.IsZero() {
+			status.NextRun = &next
+		}
+	}
+	if last, ok := s.history.last(name); ok {
+		status.LastRun = &last
+	}
+	return status
+}
+
+// History returns the kept runs of the job, or of all jobs when job is empty, the latest first.
+func (s *CalendarScheduler) History(job string) []Run {
+	return s.history.list(job)
+}
+
+// Leader reports whether this replica runs the jobs.
+func (s *CalendarScheduler) Leader(ctx context.Context) bool {
+	return s.elector == nil || s.elector.IsLeader(ctx) == nil
+}
+
+// Trigger runs a scheduled job now, outside of its schedule. It returns ErrNotLeader on
+// a replica that does not lead, the run would be skipped there. Before Start it returns
+// ErrNotStarted, gocron would block on a run requested before it started.
+func (s *CalendarScheduler) Trigger(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+	if state.paused.Load() {
+		return fmt.Errorf("%w: %s", ErrJobPaused, name)
+	}
+	job, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotScheduled, name)
+	}
+	if !s.started.Load() {
+		return ErrNotStarted
+	}
+	if s.elector != nil {
+		if err := s.elector.IsLeader(ctx); err != nil {
+			return fmt.Errorf("%w: %w", ErrNotLeader, err)
+		}
+	}
+	if err := job.job.RunNow(); err != nil {
+		return fmt.Errorf("trigger job %s : %w", name, err)
+	}
+	s.lg.InfoWithParams("job triggered", map[string]string{"job": name})
+	return nil
+}
+
+// Pause skips the runs of a job until Resume, a running execution is not interrupted.
+func (s *CalendarScheduler) Pause(name string) error {
+	return s.setPaused(name, true)
+}
+
+func (s *CalendarScheduler) Resume(name string) error {
+	return s.setPaused(name, false)
+}
+
+func (s *CalendarScheduler) setPaused(name string, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+	if state.paused.Swap(paused) != paused {
+		msg := "job resumed"
+		if paused {
+			msg = "job paused"
+		}
+		s.lg.InfoWithParams(msg, map[string]string{"job": name})
+	}
+	return nil
+}
+
+// history keeps the latest runs of all jobs in a ring and the last run of every job.
+type history struct {
+	mu      sync.Mutex
+	runs    []Run
+	next    int
+	lastRun map[string]Run
+}
+
+func newHistory(size int) *history {
+	return &history{runs: make([]Run, 0, size), lastRun: make(map[string]Run)}
+}
+
+func (h *history) add(r Run) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastRun[r.Job] = r
+	switch {
+	case cap(h.runs) == 0:
+	case len(h.runs) < cap(h.runs):
+		h.runs = append(h.runs, r)
+	default:
+		h.runs[h.next] = r
+		h.next = (h.next + 1) % len(h.runs)
+	}
+}
+
+func (h *history) last(job string) (Run, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r, ok := h.lastRun[job]
+	return r, ok
+}
+
+func (h *history) list(job string) []Run {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs := make([]Run, 0, len(h.runs))
+	for i := range h.runs {
+		// Walk back from the latest run.
+		r := h.runs[(h.next-1-i+2*len(h.runs))%len(h.runs)]
+		if job == "" || r.Job == job {
+			runs = append(runs, r)
+		}
+	}
+	return runs
+}
@@ -2,7 +2,12 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-co-op/gocron/v2"
 )
@@ -13,50 +18,223 @@ type Logger interface {
 	Info(msg string)
 }
 
+var ErrUnknownJob = errors.New("unknown job")
+
+// Elector elects the replica that runs the jobs, IsLeader returns an error on the other replicas.
+type Elector interface {
+	IsLeader(ctx context.Context) error
+}
+
 type CalendarScheduler struct {
 	scheduler gocron.Scheduler
+	elector   Elector
 	lg        Logger
+	mu        sync.Mutex
+	registry  map[string]JobFunc
+	states    map[string]*jobState
+	jobs      map[string]scheduledJob
+	history   *history
+	started   atomic.Bool
 }
 
-type Job struct {
-	Function       any
-	FunctionParams []any
-	Cron           string
+// JobFunc is a job registered by name, ctx is done when the run times out or the scheduler stops.
+// The error is kept as the result of the run.
+type JobFunc func(ctx context.Context) error
+
+// JobDefinition declares when and how a registered job runs, it runs by Cron or every Interval.
+// A singleton job skips a run while the previous one is still running. Every run waits a random
+// duration up to Jitter first and is cancelled after Timeout, zero values disable both.
+type JobDefinition struct {
+	Name      string
+	Enabled   bool
+	Cron      string
+	Interval  time.Duration
+	Timeout   time.Duration
+	Singleton bool
+	Jitter    time.Duration
 }
 
-func NewScheduler(lg Logger) *CalendarScheduler {
-	scheduler, _ := gocron.NewScheduler()
+type scheduledJob struct {
+	JobDefinition
+	job gocron.Job
+}
+
+// NewScheduler runs the jobs on the replica elected by elector, a nil elector runs them on every replica.
+// The latest historySize runs are kept in memory.
+func NewScheduler(lg Logger, elector Elector, historySize int) *CalendarScheduler {
+	var options []gocron.SchedulerOption
+	if elector != nil {
+		options = append(options, gocron.WithDistributedElector(elector))
+	}
+	scheduler, _ := gocron.NewScheduler(options...)
 	return &CalendarScheduler{
 		scheduler: scheduler,
+		elector:   elector,
 		lg:        lg,
+		registry:  make(map[string]JobFunc),
+		states:    make(map[string]*jobState),
+		jobs:      make(map[string]scheduledJob),
+		history:   newHistory(historySize),
 	}
 }
 
-func (s *CalendarScheduler) CreateJobs(jobs []Job) error {
-	for _, job := range jobs {
-		var j gocron.Job
-		var err error
-		if job.FunctionParams != nil {
-			j, err = s.scheduler.NewJob(
-				gocron.CronJob(job.Cron, false),
-				gocron.NewTask(job.Function, job.FunctionParams),
-			)
-		} else {
-			j, err = s.scheduler.NewJob(
-				gocron.CronJob(job.Cron, false),
-				gocron.NewTask(job.Function),
-			)
+// Register makes fn available to the job definitions as name.
+func (s *CalendarScheduler) Register(name string, fn JobFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registry[name] = fn
+	if _, ok := s.states[name]; !ok {
+		s.states[name] = &jobState{}
+	}
+}
+
+// Apply creates, changes and removes the jobs to match definitions, running executions are not interrupted.
+// The jobs are left as they are when any of the definitions is invalid.
+func (s *CalendarScheduler) Apply(definitions []JobDefinition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.validate(definitions); err != nil {
+		return err
+	}
+	enabled := make(map[string]bool, len(definitions))
+	for _, d := range definitions {
+		enabled[d.Name] = d.Enabled
+	}
+	for name, job := range s.jobs {
+		if enabled[name] {
+			continue
 		}
-		if err != nil {
-			return fmt.Errorf("create job : %w", err)
+		if err := s.scheduler.RemoveJob(job.job.ID()); err != nil {
+			return fmt.Errorf("remove job %s : %w", name, err)
+		}
+		delete(s.jobs, name)
+		s.lg.InfoWithParams("job removed", map[string]string{"job": name})
+	}
+	for _, d := range definitions {
+		if !d.Enabled {
+			continue
+		}
+		if err := s.schedule(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks that Apply would accept definitions, the jobs are not changed.
+func (s *CalendarScheduler) Validate(definitions []JobDefinition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.validate(definitions)
+}
+
+// validate builds the enabled definitions on a scheduler that is never started,
+// gocron checks a definition only when the job is created.
+func (s *CalendarScheduler) validate(definitions []JobDefinition) error {
+	dry, err := gocron.NewScheduler()
+	if err != nil {
+		return fmt.Errorf("create scheduler : %w", err)
+	}
+	defer func() { _ = dry.Shutdown() }()
+	for _, d := range definitions {
+		if _, ok := s.registry[d.Name]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownJob, d.Name)
+		}
+		if !d.Enabled {
+			continue
+		}
+		if _, err := dry.NewJob(d.definition(), gocron.NewTask(func() {}), d.options()...); err != nil {
+			return fmt.Errorf("schedule job %s : %w", d.Name, err)
 		}
-		s.lg.InfoWithParams("job successfully created", map[string]string{"jobId": j.ID().String()})
 	}
 	return nil
 }
 
+func (s *CalendarScheduler) schedule(d JobDefinition) error {
+	job, ok := s.jobs[d.Name]
+	if ok && job.JobDefinition == d {
+		return nil
+	}
+	options := d.options()
+	var (
+		j   gocron.Job
+		err error
+	)
+	if ok {
+		j, err = s.scheduler.Update(job.job.ID(), d.definition(), s.task(d), options...)
+	} else {
+		j, err = s.scheduler.NewJob(d.definition(), s.task(d), options...)
+	}
+	if err != nil {
+		return fmt.Errorf("schedule job %s : %w", d.Name, err)
+	}
+	s.jobs[d.Name] = scheduledJob{JobDefinition: d, job: j}
+	s.lg.InfoWithParams("job scheduled", map[string]string{
+		"job":      d.Name,
+		"jobId":    j.ID().String(),
+		"schedule": d.schedule(),
+	})
+	return nil
+}
+
+func (d JobDefinition) definition() gocron.JobDefinition {
+	if d.Cron != "" {
+		return gocron.CronJob(d.Cron, false)
+	}
+	return gocron.DurationJob(d.Interval)
+}
+
+func (d JobDefinition) options() []gocron.JobOption {
+	options := []gocron.JobOption{gocron.WithName(d.Name)}
+	if d.Singleton {
+		options = append(options, gocron.WithSingletonMode(gocron.LimitModeReschedule))
+	}
+	return options
+}
+
+func (d JobDefinition) schedule() string {
+	if d.Cron != "" {
+		return d.Cron
+	}
+	return "every " + d.Interval.String()
+}
+
+// task runs the registered function unless the job is paused, gocron passes the context of the job.
+func (s *CalendarScheduler) task(d JobDefinition) gocron.Task {
+	fn, state := s.registry[d.Name], s.states[d.Name]
+	return gocron.NewTask(func(ctx context.Context) {
+		if state.paused.Load() {
+			return
+		}
+		if d.Jitter > 0 {
+			t := time.NewTimer(rand.N(d.Jitter)) //nolint:gosec
+			defer t.Stop()
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+		if d.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+			defer cancel()
+		}
+		state.running.Add(1)
+		defer state.running.Add(-1)
+		start := time.Now()
+		err := fn(ctx)
+		run := Run{Job: d.Name, Started: start, DurationSeconds: time.Since(start).Seconds()}
+		if err != nil {
+			run.Error = err.Error()
+		}
+		s.history.add(run)
+	})
+}
+
 func (s *CalendarScheduler) Start(ctx context.Context) {
 	s.scheduler.Start()
+	s.started.Store(true)
 	s.lg.Info("scheduler starts ...")
 	<-ctx.Done()
 }
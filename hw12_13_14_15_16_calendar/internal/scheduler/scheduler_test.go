@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testSchedulerLogger struct{}
+
+func (testSchedulerLogger) InfoWithParams(string, map[string]string) {}
+
+func (testSchedulerLogger) Error(string, error) {}
+
+func (testSchedulerLogger) Info(string) {}
+
+// start runs s until the test ends and waits until it is started.
+func start(t *testing.T, s *CalendarScheduler) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		s.Shutdown()
+	})
+	require.Eventually(t, s.started.Load, time.Second, time.Millisecond)
+}
+
+func TestApply(t *testing.T) {
+	s := NewScheduler(testSchedulerLogger{}, nil, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		s.Shutdown()
+	})
+
+	var runs, timeouts atomic.Int32
+	s.Register("count", func(context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	s.Register("wait", func(ctx context.Context) error {
+		<-ctx.Done()
+		timeouts.Add(1)
+		return ctx.Err()
+	})
+
+	require.ErrorIs(t, s.Apply([]JobDefinition{{Name: "unknown", Enabled: true, Interval: time.Second}}), ErrUnknownJob)
+
+	definitions := []JobDefinition{
+		{Name: "count", Enabled: true, Interval: 10 * time.Millisecond},
+		{Name: "wait", Enabled: true, Interval: 10 * time.Millisecond, Timeout: 10 * time.Millisecond, Singleton: true},
+	}
+	require.NoError(t, s.Apply(definitions))
+	require.Eventually(t, func() bool { return runs.Load() > 0 && timeouts.Load() > 0 }, time.Second, time.Millisecond)
+
+	invalid := []JobDefinition{
+		{Name: "count", Enabled: true, Interval: time.Hour},
+		{Name: "wait", Enabled: true, Cron: "every minute"},
+	}
+	require.Error(t, s.Validate(invalid))
+	require.Error(t, s.Apply(invalid))
+	require.Equal(t, definitions[0], s.jobs["count"].JobDefinition, "a refused definition changes no job")
+
+	definitions[0].Enabled = false
+	require.NoError(t, s.Validate(definitions))
+	require.NoError(t, s.Apply(definitions))
+	require.NotContains(t, s.jobs, "count")
+	stopped := runs.Load()
+	time.Sleep(50 * time.Millisecond)
+	require.LessOrEqual(t, runs.Load(), stopped+1, "a removed job does not run again")
+
+	require.NoError(t, s.Apply(nil))
+	require.Empty(t, s.jobs)
+}
+
+func TestPauseTrigger(t *testing.T) {
+	ctx := context.Background()
+	s := NewScheduler(testSchedulerLogger{}, nil, 2)
+
+	var runs atomic.Int32
+	s.Register("count", func(context.Context) error {
+		if runs.Add(1)%2 == 0 {
+			return errors.New("even run")
+		}
+		return nil
+	})
+	s.Register("idle", func(context.Context) error { return nil })
+	require.NoError(t, s.Apply([]JobDefinition{{Name: "count", Enabled: true, Cron: "0 0 1 1 *"}}))
+	require.ErrorIs(t, s.Trigger(ctx, "count"), ErrNotStarted)
+	start(t, s)
+
+	require.ErrorIs(t, s.Trigger(ctx, "unknown"), ErrUnknownJob)
+	require.ErrorIs(t, s.Trigger(ctx, "idle"), ErrJobNotScheduled)
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, s.Trigger(ctx, "count"))
+		require.Eventually(t, func() bool {
+			status, err := s.Job("count")
+			return err == nil && runs.Load() == int32(i) && !status.Running
+		}, time.Second, time.Millisecond)
+	}
+	history := s.History("count")
+	require.Len(t, history, 2, "only the latest runs are kept")
+	require.Empty(t, history[0].Error, "the latest run comes first")
+	require.Equal(t, "even run", history[1].Error)
+
+	status, err := s.Job("count")
+	require.NoError(t, err)
+	require.Equal(t, "0 0 1 1 *", status.Schedule)
+	require.NotNil(t, status.NextRun)
+	require.Equal(t, history[0], *status.LastRun)
+
+	require.NoError(t, s.Pause("count"))
+	require.ErrorIs(t, s.Trigger(ctx, "count"), ErrJobPaused)
+	require.NoError(t, s.Resume("count"))
+	require.NoError(t, s.Trigger(ctx, "count"))
+	require.Eventually(t, func() bool { return runs.Load() == 4 }, time.Second, time.Millisecond)
+
+	jobs := s.Jobs()
+	require.Len(t, jobs, 2)
+	require.Equal(t, "count", jobs[0].Name)
+	require.Empty(t, jobs[1].Schedule)
+}
+
+type testElector struct {
+	leading atomic.Bool
+}
+
+func (e *testElector) IsLeader(context.Context) error {
+	if !e.leading.Load() {
+		return errors.New("not leading")
+	}
+	return nil
+}
+
+func TestTriggerNotLeader(t *testing.T) {
+	elector := &testElector{}
+	s := NewScheduler(testSchedulerLogger{}, elector, 2)
+	ctx := context.Background()
+	start(t, s)
+
+	var runs atomic.Int32
+	s.Register("count", func(context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	require.NoError(t, s.Apply([]JobDefinition{{Name: "count", Enabled: true, Cron: "0 0 1 1 *"}}))
+
+	require.False(t, s.Leader(ctx))
+	require.ErrorIs(t, s.Trigger(ctx, "count"), ErrNotLeader)
+
+	elector.leading.Store(true)
+	require.True(t, s.Leader(ctx))
+	require.NoError(t, s.Trigger(ctx, "count"))
+	require.Eventually(t, func() bool { return runs.Load() == 1 }, time.Second, time.Millisecond)
+}
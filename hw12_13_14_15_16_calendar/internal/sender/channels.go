@@ -0,0 +1,193 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/requestid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// LogChannel writes the notifications to the log, it needs no address. The fields of the notification
+// are logged instead of the rendered text, so the ones listed in logging.redact stay hidden.
+type LogChannel struct {
+	logger Logger
+}
+
+func NewLogChannel(logger Logger) LogChannel {
+	return LogChannel{logger: logger}
+}
+
+func (c LogChannel) Send(ctx context.Context, to Recipient, msg Message) error {
+	c.logger.InfoCtx(ctx, "notification", map[string]string{
+		"userId":   to.UserID,
+		"eventId":  msg.Notification.ID,
+		"title":    msg.Notification.Title,
+		"startsAt": msg.Notification.StartsAt.Format(time.RFC3339),
+	})
+	return nil
+}
+
+type SMTPSettings struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Timeout  time.Duration
+}
+
+// SMTPChannel sends plain text emails, over STARTTLS when the server offers it.
+type SMTPChannel struct {
+	settings SMTPSettings
+}
+
+func NewSMTPChannel(settings SMTPSettings) SMTPChannel {
+	return SMTPChannel{settings: settings}
+}
+
+func (c SMTPChannel) Send(ctx context.Context, to Recipient, msg Message) error {
+	if to.Email == "" {
+		return fmt.Errorf("%w: no email address", errPermanent)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.settings.Timeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.settings.Host, strconv.Itoa(c.settings.Port)))
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return errors.Join(err, conn.Close())
+	}
+	client, err := smtp.NewClient(conn, c.settings.Host)
+	if err != nil {
+		return errors.Join(err, conn.Close())
+	}
+	defer client.Close()
+	if err := c.send(client, to.Email, msg); err != nil {
+		// The server rejected the message, sending it again does not help.
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+			return fmt.Errorf("%w: %w", errPermanent, err)
+		}
+		return err
+	}
+	return client.Quit()
+}
+
+func (c SMTPChannel) send(client *smtp.Client, to string, msg Message) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: c.settings.Host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if c.settings.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.settings.Username, c.settings.Password, c.settings.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(c.settings.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(c.email(to, msg)); err != nil {
+		return errors.Join(err, w.Close())
+	}
+	return w.Close()
+}
+
+func (c SMTPChannel) email(to string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", c.settings.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(msg.Body)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// WebhookPayload is the JSON body posted to a webhook.
+type WebhookPayload struct {
+	EventID  string    `json:"eventId"`
+	Title    string    `json:"title"`
+	DateTime time.Time `json:"dateTime"`
+	StartsAt time.Time `json:"startsAt"`
+	UserID   string    `json:"userId"`
+	Subject  string    `json:"subject"`
+	Body     string    `json:"body"`
+}
+
+// WebhookChannel posts the messages as JSON to the webhook of the recipient. Responses other than 2xx
+// are failures, they are retried on 429 and 5xx only.
+type WebhookChannel struct {
+	client *http.Client
+}
+
+func NewWebhookChannel(timeout time.Duration) WebhookChannel {
+	return WebhookChannel{client: &http.Client{
+		Timeout:   timeout,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}}
+}
+
+func (c WebhookChannel) Send(ctx context.Context, to Recipient, msg Message) error {
+	if to.WebhookURL == "" {
+		return fmt.Errorf("%w: no webhook url", errPermanent)
+	}
+	body, err := json.Marshal(WebhookPayload{
+		EventID:  msg.Notification.ID,
+		Title:    msg.Notification.Title,
+		DateTime: msg.Notification.DateTime,
+		StartsAt: msg.Notification.StartsAt,
+		UserID:   to.UserID,
+		Subject:  msg.Subject,
+		Body:     msg.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", errPermanent, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	default:
+		return fmt.Errorf("%w: webhook responded %s", errPermanent, resp.Status)
+	}
+}
@@ -0,0 +1,87 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/scheduler"
+)
+
+// Message is a notification rendered for a recipient.
+type Message struct {
+	Subject      string
+	Body         string
+	Notification scheduler.Notification
+}
+
+// Recipient is how a user gets notifications, Email and WebhookURL are the addresses for their channels.
+type Recipient struct {
+	UserID     string
+	Channel    string
+	Locale     string
+	Email      string
+	WebhookURL string
+}
+
+// Channel delivers a message to a recipient. Failures wrapping errPermanent are not retried.
+type Channel interface {
+	Send(ctx context.Context, to Recipient, msg Message) error
+}
+
+// Preferences are the recipients by user id, other users get the defaults.
+type Preferences struct {
+	defaults Recipient
+	users    map[string]Recipient
+}
+
+func NewPreferences(defaultChannel, defaultLocale string, users map[string]Recipient) Preferences {
+	return Preferences{
+		defaults: Recipient{Channel: defaultChannel, Locale: defaultLocale},
+		users:    users,
+	}
+}
+
+// Recipient returns the preference of the user with the unset fields taken from the defaults.
+func (p Preferences) Recipient(userID string) Recipient {
+	r := p.users[userID]
+	r.UserID = userID
+	if r.Channel == "" {
+		r.Channel = p.defaults.Channel
+	}
+	if r.Locale == "" {
+		r.Locale = p.defaults.Locale
+	}
+	return r
+}
+
+// Delivery sends notifications by the channel the user prefers.
+type Delivery struct {
+	preferences Preferences
+	templates   *Templates
+	channels    map[string]Channel
+}
+
+func NewDelivery(preferences Preferences, templates *Templates, channels map[string]Channel) *Delivery {
+	return &Delivery{
+		preferences: preferences,
+		templates:   templates,
+		channels:    channels,
+	}
+}
+
+func (d *Delivery) Deliver(ctx context.Context, n scheduler.Notification) error {
+	to := d.preferences.Recipient(n.UserID)
+	channel, ok := d.channels[to.Channel]
+	if !ok {
+		return fmt.Errorf("%w: unknown channel %s", errPermanent, to.Channel)
+	}
+	msg, err := d.templates.Render(to.Channel, to.Locale, n)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errPermanent, err)
+	}
+	if err := channel.Send(ctx, to, msg); err != nil {
+		return fmt.Errorf("send by %s : %w", to.Channel, err)
+	}
+	notificationsDelivered.WithLabelValues(to.Channel).Inc()
+	return nil
+}
@@ -0,0 +1,266 @@
+package sender
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/scheduler"
+)
+
+var testNotification = scheduler.Notification{
+	ID:       "0b6f1d8e-3f0a-4c1e-9d7a-5a3b2c1d0e9f",
+	Title:    "Standup",
+	DateTime: time.Date(2026, 10, 20, 9, 15, 0, 0, time.UTC),
+	StartsAt: time.Date(2026, 10, 20, 9, 30, 0, 0, time.UTC),
+	UserID:   "7c9e6679-7425-40de-944b-e07fc1f90ae7",
+}
+
+func TestTemplates(t *testing.T) {
+	templates, err := NewTemplates(map[string]map[string]TemplateSource{
+		"email": {
+			"en": {Subject: "Soon: {{.Title}}", Body: "{{.Title}} at {{.StartsAt.Format \"15:04\"}}"},
+		},
+	}, "en")
+	require.NoError(t, err)
+
+	msg, err := templates.Render("email", "en", testNotification)
+	require.NoError(t, err)
+	require.Equal(t, "Soon: Standup", msg.Subject)
+	require.Equal(t, "Standup at 09:30", msg.Body)
+
+	msg, err = templates.Render("email", "fr", testNotification)
+	require.NoError(t, err)
+	require.Equal(t, "Soon: Standup", msg.Subject, "an unknown locale falls back to the default locale of the channel")
+
+	msg, err = templates.Render("email", "ru", testNotification)
+	require.NoError(t, err)
+	require.Equal(t, "Напоминание: Standup", msg.Subject, "a locale without a channel template uses the built-in one")
+
+	msg, err = templates.Render("log", "de", testNotification)
+	require.NoError(t, err)
+	require.Equal(t, "Reminder: Standup", msg.Subject)
+	require.Equal(t, `Event "Standup" starts at 2026-10-20 09:30 UTC.`, msg.Body)
+
+	_, err = NewTemplates(map[string]map[string]TemplateSource{"log": {"en": {Subject: "{{.Title"}}}, "en")
+	require.Error(t, err)
+}
+
+// paramsLogger keeps the params of the info lines.
+type paramsLogger struct {
+	testLogger
+	params []map[string]string
+}
+
+func (l *paramsLogger) InfoCtx(_ context.Context, _ string, params map[string]string) {
+	l.params = append(l.params, params)
+}
+
+func TestLogChannel(t *testing.T) {
+	lg := &paramsLogger{}
+	to := Recipient{UserID: testNotification.UserID}
+	msg := Message{Subject: "Reminder: Standup", Body: "Standup starts soon", Notification: testNotification}
+	require.NoError(t, NewLogChannel(lg).Send(context.Background(), to, msg))
+
+	// The title is logged under its own key, where logging.redact can hide it.
+	require.Equal(t, []map[string]string{{
+		"userId":   testNotification.UserID,
+		"eventId":  testNotification.ID,
+		"title":    "Standup",
+		"startsAt": "2026-10-20T09:30:00Z",
+	}}, lg.params)
+}
+
+// fakeSMTP accepts one session at a time and keeps the received messages by recipient.
+type fakeSMTP struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	messages map[string]string
+	reject   bool
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeSMTP{ln: ln, messages: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSMTP) settings() SMTPSettings {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return SMTPSettings{
+		Host:    addr.IP.String(),
+		Port:    addr.Port,
+		From:    "calendar@example.com",
+		Timeout: time.Second,
+	}
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	var rcpt string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			if s.reject {
+				reply("550 no such user")
+				continue
+			}
+			rcpt = strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>")
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 end with .")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages[rcpt] = data.String()
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPChannel(t *testing.T) {
+	server := newFakeSMTP(t)
+	channel := NewSMTPChannel(server.settings())
+	msg := Message{Subject: "Напоминание: Standup", Body: "Событие начнётся", Notification: testNotification}
+
+	err := channel.Send(context.Background(), Recipient{Email: "user@example.com"}, msg)
+	require.NoError(t, err)
+	server.mu.Lock()
+	email := server.messages["user@example.com"]
+	server.mu.Unlock()
+	require.Contains(t, email, "From: calendar@example.com\r\n")
+	require.Contains(t, email, "Subject: =?utf-8?q?")
+	require.True(t, strings.HasSuffix(email, "\r\n\r\nСобытие начнётся\r\n"))
+
+	require.ErrorIs(t, channel.Send(context.Background(), Recipient{}, msg), errPermanent)
+
+	server.reject = true
+	err = channel.Send(context.Background(), Recipient{Email: "unknown@example.com"}, msg)
+	require.ErrorIs(t, err, errPermanent, "a rejected recipient is not retried")
+
+	settings := server.settings()
+	settings.Port = closedPort(t)
+	err = NewSMTPChannel(settings).Send(context.Background(), Recipient{Email: "user@example.com"}, msg)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, errPermanent, "an unavailable server is retried")
+}
+
+func closedPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	require.NoError(t, ln.Close())
+	return port
+}
+
+func TestWebhookChannel(t *testing.T) {
+	var (
+		status   = http.StatusNoContent
+		received WebhookPayload
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	channel := NewWebhookChannel(time.Second)
+	to := Recipient{UserID: testNotification.UserID, WebhookURL: server.URL}
+	msg := Message{Subject: "Reminder: Standup", Body: "soon", Notification: testNotification}
+	require.NoError(t, channel.Send(context.Background(), to, msg))
+	require.Equal(t, testNotification.ID, received.EventID)
+	require.Equal(t, "Reminder: Standup", received.Subject)
+	require.True(t, testNotification.DateTime.Equal(received.DateTime))
+	require.True(t, testNotification.StartsAt.Equal(received.StartsAt), "the payload carries the start of the event")
+
+	status = http.StatusServiceUnavailable
+	err := channel.Send(context.Background(), to, msg)
+	require.ErrorContains(t, err, strconv.Itoa(status))
+	require.NotErrorIs(t, err, errPermanent)
+
+	status = http.StatusNotFound
+	require.ErrorIs(t, channel.Send(context.Background(), to, msg), errPermanent)
+	require.ErrorIs(t, channel.Send(context.Background(), Recipient{}, msg), errPermanent)
+}
+
+type recordingChannel struct {
+	sent []Recipient
+}
+
+func (c *recordingChannel) Send(_ context.Context, to Recipient, _ Message) error {
+	c.sent = append(c.sent, to)
+	return nil
+}
+
+func TestDeliveryUsesPreferences(t *testing.T) {
+	templates, err := NewTemplates(nil, "en")
+	require.NoError(t, err)
+	log, webhook := &recordingChannel{}, &recordingChannel{}
+	preferences := NewPreferences("log", "en", map[string]Recipient{
+		testNotification.UserID: {Channel: "webhook", Locale: "ru", WebhookURL: "http://hooks.local/calendar"},
+	})
+	d := NewDelivery(preferences, templates, map[string]Channel{"log": log, "webhook": webhook})
+
+	require.NoError(t, d.Deliver(context.Background(), testNotification))
+	other := testNotification
+	other.UserID = "9b2f3c4d-0000-4000-8000-000000000000"
+	require.NoError(t, d.Deliver(context.Background(), other))
+
+	require.Equal(t, []Recipient{{
+		UserID: testNotification.UserID, Channel: "webhook", Locale: "ru", WebhookURL: "http://hooks.local/calendar",
+	}}, webhook.sent)
+	require.Equal(t, []Recipient{{UserID: other.UserID, Channel: "log", Locale: "en"}}, log.sent)
+
+	d = NewDelivery(preferences, templates, map[string]Channel{"log": log})
+	require.ErrorIs(t, d.Deliver(context.Background(), testNotification), errPermanent)
+}
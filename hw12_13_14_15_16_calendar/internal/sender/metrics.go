@@ -0,0 +1,51 @@
+package sender
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	messagesConsumed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "sender",
+		Name:      "messages_consumed_total",
+		Help:      "Number of notification messages consumed from the queue.",
+	})
+
+	processingErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "sender",
+		Name:      "processing_errors_total",
+		Help:      "Number of messages that failed processing by reason.",
+	}, []string{"reason"})
+
+	messagesRetried = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "sender",
+		Name:      "messages_retried_total",
+		Help:      "Number of failed messages published to the retry queue.",
+	})
+
+	messagesDeadLettered = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "sender",
+		Name:      "messages_dead_lettered_total",
+		Help:      "Number of messages published to the dead-letter queue.",
+	})
+
+	notificationsDelivered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "sender",
+		Name:      "notifications_delivered_total",
+		Help:      "Number of notifications delivered by channel.",
+	}, []string{"channel"})
+
+	notificationDelay = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "calendar",
+		Subsystem: "sender",
+		Name:      "notification_delay_seconds",
+		Help:      "Delay between the notification time of an event and its processing by the sender.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 15, 30, 60, 120, 300, 600},
+	})
+)
@@ -3,26 +3,51 @@ package sender
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/client"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/requestid"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/scheduler"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type Logger interface {
 	InfoWithParams(msg string, params map[string]string)
 	Info(msg string)
 	ErrorWithParams(msg string, params map[string]string, err error)
+	InfoCtx(ctx context.Context, msg string, params map[string]string)
+	ErrorCtx(ctx context.Context, msg string, params map[string]string, err error)
 }
 
 type NotificationConsumer interface {
-	Consume(queueName string) (<-chan amqp.Delivery, error)
+	Consume(queueName string, prefetch int) (<-chan amqp.Delivery, error)
+	Retry(ctx context.Context, queueName string, msg amqp.Delivery, delay time.Duration) error
+	DeadLetter(ctx context.Context, queueName string, msg amqp.Delivery, reason error) error
+}
+
+type Deliverer interface {
+	Deliver(ctx context.Context, n scheduler.Notification) error
 }
 
 type Storage interface {
-	Update(ctx context.Context, newEvent storage.Event) error
+	Update(ctx context.Context, newEvent storage.Event, fields ...storage.Field) error
+}
+
+// errPermanent marks a message that fails on every delivery, it goes to the dead-letter queue at once.
+var errPermanent = errors.New("permanent failure")
+
+// Settings of the redelivery of failed messages.
+type Settings struct {
+	Prefetch       int
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
 }
 
 type NotificationSender struct {
@@ -30,58 +55,187 @@ type NotificationSender struct {
 	queueName string
 	logger    Logger
 	storage   Storage
+	delivery  Deliverer
+	settings  Settings
 }
 
 func NewNotificationSender(
-	consumer NotificationConsumer, queueName string, logger Logger, storage Storage,
+	consumer NotificationConsumer, queueName string, logger Logger, storage Storage, delivery Deliverer,
+	settings Settings,
 ) NotificationSender {
 	return NotificationSender{
 		consumer:  consumer,
 		queueName: queueName,
 		logger:    logger,
 		storage:   storage,
+		delivery:  delivery,
+		settings:  settings,
 	}
 }
 
+// StartListening processes the messages until ctx is done. A failed message is retried or dead-lettered
+// and the sender goes on, when the delivery channel closes the queue is consumed again. While the consumer
+// reconnects, Consume is retried with the delay doubled up to a minute.
 func (n NotificationSender) StartListening(ctx context.Context) {
-	messages, err := n.consumer.Consume(n.queueName)
-	for err != nil {
-		n.logger.ErrorWithParams(
-			"consume messages", map[string]string{
-				"queueName": n.queueName,
-			},
-			err,
-		)
-		time.Sleep(time.Second * 60)
-		messages, err = n.consumer.Consume(n.queueName)
-	}
-	n.logger.Info("start listening queue with name " + n.queueName)
+	delay := time.Second
 	for {
-		select {
-		case <-ctx.Done():
-			return
-		case msg := <-messages:
-			body := string(msg.Body)
-			n.logger.InfoWithParams("got message", map[string]string{"queueName": n.queueName, "message": body})
-			var notification scheduler.Notification
-			err := json.Unmarshal(msg.Body, &notification)
-			if err != nil {
-				n.logger.ErrorWithParams(
-					"unmarshal notification", map[string]string{"queueName": n.queueName, "message": body}, err,
-				)
+		messages, err := n.consumer.Consume(n.queueName, n.settings.Prefetch)
+		if err != nil {
+			n.logger.ErrorWithParams(
+				"consume messages", map[string]string{
+					"queueName": n.queueName,
+				},
+				err,
+			)
+			if !sleep(ctx, delay) {
 				return
 			}
-			status := "SENT"
-			err = n.storage.Update(context.Background(), storage.Event{
-				ID:                 uuid.MustParse(notification.ID),
-				NotificationStatus: &status,
-			})
-			if err != nil {
-				n.logger.ErrorWithParams(
-					"update status to SENT", map[string]string{"queueName": n.queueName, "message": body}, err,
-				)
-				return
+			delay = min(2*delay, time.Minute)
+			continue
+		}
+		delay = time.Second
+		n.logger.Info("start listening queue with name " + n.queueName)
+		if !n.listen(ctx, messages) {
+			return
+		}
+		n.logger.Info("delivery channel of queue " + n.queueName + " is closed")
+		if !sleep(ctx, time.Second) {
+			return
+		}
+	}
+}
+
+// listen returns false when ctx is done and true when messages is closed.
+func (n NotificationSender) listen(ctx context.Context, messages <-chan amqp.Delivery) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case msg, ok := <-messages:
+			if !ok {
+				return true
 			}
+			n.handle(ctx, msg)
 		}
 	}
 }
+
+// handle acknowledges msg after it is processed, retried or dead-lettered. A message that could not
+// be republished is returned to the queue.
+func (n NotificationSender) handle(ctx context.Context, msg amqp.Delivery) {
+	ctx, span := client.StartConsumeSpan(ctx, n.queueName, msg)
+	defer span.End()
+	// Messages published by the scheduler carry the request ID of the job run.
+	id, _ := msg.Headers[requestid.Header].(string)
+	ctx = requestid.NewContext(ctx, requestid.Accept(id))
+
+	err := n.process(ctx, msg)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		err = n.redeliver(ctx, msg, err)
+	}
+	if err != nil {
+		n.logger.ErrorCtx(ctx, "return message to queue", map[string]string{"queueName": n.queueName}, err)
+		if err := msg.Nack(false, true); err != nil {
+			n.logger.ErrorCtx(ctx, "nack message", map[string]string{"queueName": n.queueName}, err)
+		}
+		return
+	}
+	if err := msg.Ack(false); err != nil {
+		n.logger.ErrorCtx(ctx, "ack message", map[string]string{"queueName": n.queueName}, err)
+	}
+}
+
+// redeliver retries msg after a backoff, or dead-letters it when the failure is permanent
+// or the attempts are exhausted.
+func (n NotificationSender) redeliver(ctx context.Context, msg amqp.Delivery, failure error) error {
+	attempt := client.Attempts(msg) + 1
+	params := map[string]string{
+		"queueName": n.queueName,
+		"attempt":   strconv.Itoa(attempt),
+		"eventId":   eventID(msg.Body),
+	}
+	if errors.Is(failure, errPermanent) || attempt >= n.settings.MaxAttempts {
+		if err := n.consumer.DeadLetter(ctx, n.queueName, msg, failure); err != nil {
+			return err
+		}
+		messagesDeadLettered.Inc()
+		n.logger.ErrorCtx(ctx, "message is dead-lettered", params, failure)
+		return nil
+	}
+	delay := n.backoff(attempt)
+	if err := n.consumer.Retry(ctx, n.queueName, msg, delay); err != nil {
+		return err
+	}
+	messagesRetried.Inc()
+	params["delay"] = delay.String()
+	n.logger.ErrorCtx(ctx, "message is retried", params, failure)
+	return nil
+}
+
+// backoff doubles the delay with every attempt.
+func (n NotificationSender) backoff(attempt int) time.Duration {
+	delay := n.settings.InitialBackoff
+	for i := 1; i < attempt && delay < n.settings.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, n.settings.MaxBackoff)
+}
+
+func (n NotificationSender) process(ctx context.Context, msg amqp.Delivery) error {
+	messagesConsumed.Inc()
+	n.logger.InfoCtx(ctx, "got message", map[string]string{"queueName": n.queueName, "eventId": eventID(msg.Body)})
+	var notification scheduler.Notification
+	if err := json.Unmarshal(msg.Body, &notification); err != nil {
+		processingErrors.WithLabelValues("unmarshal").Inc()
+		return fmt.Errorf("%w: unmarshal notification : %w", errPermanent, err)
+	}
+	eventID, err := uuid.Parse(notification.ID)
+	if err != nil {
+		processingErrors.WithLabelValues("unmarshal").Inc()
+		return fmt.Errorf("%w: parse event id : %w", errPermanent, err)
+	}
+	// A notification delivered again after a failed status update is sent twice.
+	if err := n.delivery.Deliver(ctx, notification); err != nil {
+		processingErrors.WithLabelValues("deliver").Inc()
+		return fmt.Errorf("deliver notification : %w", err)
+	}
+	status := "SENT"
+	err = n.storage.Update(ctx, storage.Event{
+		ID:                 eventID,
+		NotificationStatus: &status,
+	})
+	if errors.Is(err, storage.ErrEventNotFoundErr) {
+		// The event was deleted after the notification had been published.
+		n.logger.InfoCtx(ctx, "event of notification not found", map[string]string{"eventId": notification.ID})
+		return nil
+	}
+	if err != nil {
+		processingErrors.WithLabelValues("update_status").Inc()
+		return fmt.Errorf("update status to SENT : %w", err)
+	}
+	notificationDelay.Observe(time.Since(notification.DateTime).Seconds())
+	return nil
+}
+
+// eventID returns the event of a message for the logs, they do not get the body as it may hold
+// values hidden by logging.redact. It is empty when the message can not be parsed.
+func eventID(body []byte) string {
+	var notification struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(body, &notification)
+	return notification.ID
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,164 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/client"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/scheduler"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/storagetest"
+)
+
+type testLogger struct{}
+
+func (testLogger) InfoWithParams(string, map[string]string) {}
+
+func (testLogger) Info(string) {}
+
+func (testLogger) ErrorWithParams(string, map[string]string, error) {}
+
+func (testLogger) InfoCtx(context.Context, string, map[string]string) {}
+
+func (testLogger) ErrorCtx(context.Context, string, map[string]string, error) {}
+
+// testConsumer delivers the queued messages and records where the failed ones were republished.
+type testConsumer struct {
+	mu         sync.Mutex
+	messages   chan amqp.Delivery
+	retried    []time.Duration
+	deadLetter []string
+}
+
+func (c *testConsumer) Consume(string, int) (<-chan amqp.Delivery, error) {
+	return c.messages, nil
+}
+
+func (c *testConsumer) Retry(_ context.Context, _ string, _ amqp.Delivery, delay time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retried = append(c.retried, delay)
+	return nil
+}
+
+func (c *testConsumer) DeadLetter(_ context.Context, _ string, _ amqp.Delivery, reason error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadLetter = append(c.deadLetter, reason.Error())
+	return nil
+}
+
+type testAcknowledger struct {
+	acked, nacked chan uint64
+}
+
+func (a testAcknowledger) Ack(tag uint64, _ bool) error {
+	a.acked <- tag
+	return nil
+}
+
+func (a testAcknowledger) Nack(tag uint64, _ bool, _ bool) error {
+	a.nacked <- tag
+	return nil
+}
+
+func (a testAcknowledger) Reject(tag uint64, _ bool) error {
+	a.nacked <- tag
+	return nil
+}
+
+func newLogDelivery(t *testing.T) *Delivery {
+	t.Helper()
+	templates, err := NewTemplates(nil, "en")
+	require.NoError(t, err)
+	return NewDelivery(NewPreferences("log", "en", nil), templates, map[string]Channel{"log": NewLogChannel(testLogger{})})
+}
+
+type failingStorage struct{}
+
+func (failingStorage) Update(context.Context, storage.Event, ...storage.Field) error {
+	return errors.New("connection refused")
+}
+
+func TestStartListening(t *testing.T) {
+	settings := Settings{Prefetch: 1, MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}
+	ack := testAcknowledger{acked: make(chan uint64, 10), nacked: make(chan uint64, 10)}
+	deliver := func(c *testConsumer, tag uint64, body []byte, attempts int) {
+		c.messages <- amqp.Delivery{
+			Acknowledger: ack,
+			DeliveryTag:  tag,
+			Headers:      amqp.Table{client.AttemptsHeader: int32(attempts)},
+			Body:         body,
+		}
+	}
+	listen := func(t *testing.T, c *testConsumer, s Storage) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			NewNotificationSender(c, "queue", testLogger{}, s, newLogDelivery(t), settings).StartListening(ctx)
+		}()
+		t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+	}
+
+	t.Run("poison messages are dead-lettered and the sender goes on", func(t *testing.T) {
+		s := memorystorage.New()
+		e := storagetest.NewEvent()
+		require.NoError(t, s.Create(context.Background(), e))
+		body, err := json.Marshal(scheduler.Notification{ID: e.ID.String(), DateTime: time.Now()})
+		require.NoError(t, err)
+
+		c := &testConsumer{messages: make(chan amqp.Delivery)}
+		listen(t, c, s)
+		deliver(c, 1, []byte("not json"), 0)
+		deliver(c, 2, []byte(`{"id":"not uuid"}`), 0)
+		deliver(c, 3, body, 0)
+		for tag := uint64(1); tag <= 3; tag++ {
+			require.Equal(t, tag, <-ack.acked)
+		}
+
+		c.mu.Lock()
+		require.Len(t, c.deadLetter, 2)
+		require.Empty(t, c.retried)
+		c.mu.Unlock()
+		got, err := s.GetByID(context.Background(), e.ID)
+		require.NoError(t, err)
+		require.Equal(t, "SENT", *got.NotificationStatus)
+	})
+
+	t.Run("failed messages are retried with backoff until attempts are exhausted", func(t *testing.T) {
+		body, err := json.Marshal(scheduler.Notification{ID: storagetest.NewEvent().ID.String()})
+		require.NoError(t, err)
+
+		c := &testConsumer{messages: make(chan amqp.Delivery)}
+		listen(t, c, failingStorage{})
+		for attempts := 0; attempts < settings.MaxAttempts; attempts++ {
+			deliver(c, uint64(attempts), body, attempts)
+			require.Equal(t, uint64(attempts), <-ack.acked)
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		require.Equal(t, []time.Duration{time.Second, 2 * time.Second}, c.retried)
+		require.Len(t, c.deadLetter, 1)
+		require.Contains(t, c.deadLetter[0], "connection refused")
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	n := NotificationSender{settings: Settings{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}}
+	require.Equal(t, time.Second, n.backoff(1))
+	require.Equal(t, 4*time.Second, n.backoff(3))
+	require.Equal(t, 5*time.Second, n.backoff(10))
+}
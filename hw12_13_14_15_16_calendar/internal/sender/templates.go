@@ -0,0 +1,100 @@
+package sender
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/scheduler"
+)
+
+// TemplateSource is the text/template source of a message, the notification is passed as the data.
+type TemplateSource struct {
+	Subject string
+	Body    string
+}
+
+// builtinTemplates are used by every channel unless overridden.
+var builtinTemplates = map[string]TemplateSource{
+	"en": {
+		Subject: `Reminder: {{.Title}}`,
+		Body:    `Event "{{.Title}}" starts at {{.StartsAt.Format "2006-01-02 15:04 MST"}}.`,
+	},
+	"ru": {
+		Subject: `Напоминание: {{.Title}}`,
+		Body:    `Событие «{{.Title}}» начнётся {{.StartsAt.Format "02.01.2006 15:04 MST"}}.`,
+	},
+}
+
+type messageTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// Templates render messages by channel and locale. A locale the channel has no template for
+// uses the built-in one, a locale without any template falls back to the default locale.
+type Templates struct {
+	defaultLocale string
+	channels      map[string]map[string]messageTemplate
+	builtin       map[string]messageTemplate
+}
+
+func NewTemplates(sources map[string]map[string]TemplateSource, defaultLocale string) (*Templates, error) {
+	t := &Templates{
+		defaultLocale: defaultLocale,
+		channels:      make(map[string]map[string]messageTemplate, len(sources)),
+	}
+	var err error
+	if t.builtin, err = parseTemplates(builtinTemplates); err != nil {
+		return nil, err
+	}
+	for channel, locales := range sources {
+		if t.channels[channel], err = parseTemplates(locales); err != nil {
+			return nil, fmt.Errorf("templates of %s : %w", channel, err)
+		}
+	}
+	return t, nil
+}
+
+func parseTemplates(sources map[string]TemplateSource) (map[string]messageTemplate, error) {
+	templates := make(map[string]messageTemplate, len(sources))
+	for locale, source := range sources {
+		subject, err := template.New(locale + " subject").Parse(source.Subject)
+		if err != nil {
+			return nil, err
+		}
+		body, err := template.New(locale + " body").Parse(source.Body)
+		if err != nil {
+			return nil, err
+		}
+		templates[locale] = messageTemplate{subject: subject, body: body}
+	}
+	return templates, nil
+}
+
+func (t *Templates) Render(channel, locale string, n scheduler.Notification) (Message, error) {
+	tmpl := t.lookup(channel, locale)
+	msg := Message{Notification: n}
+	var buf bytes.Buffer
+	if err := tmpl.subject.Execute(&buf, n); err != nil {
+		return msg, fmt.Errorf("render subject : %w", err)
+	}
+	msg.Subject = buf.String()
+	buf.Reset()
+	if err := tmpl.body.Execute(&buf, n); err != nil {
+		return msg, fmt.Errorf("render body : %w", err)
+	}
+	msg.Body = buf.String()
+	return msg, nil
+}
+
+func (t *Templates) lookup(channel, locale string) messageTemplate {
+	for _, l := range []string{locale, t.defaultLocale} {
+		for _, templates := range []map[string]messageTemplate{t.channels[channel], t.builtin} {
+			if tmpl, ok := templates[l]; ok {
+				return tmpl
+			}
+		}
+	}
+	return t.builtin["en"]
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"time"
 
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/requestid"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 type GrpcLoggingInterceptor struct {
@@ -24,10 +27,43 @@ func (l GrpcLoggingInterceptor) grpcLoggingMiddleware(
 	start := time.Now()
 	resp, err := handler(ctx, req)
 	latency := time.Since(start)
-	l.lg.InfoWithParams("", map[string]string{
+	l.lg.AccessCtx(ctx, "", map[string]string{
 		"path":     info.FullMethod,
+		"code":     status.Code(err).String(),
 		"latency":  latency.String(),
 		"protocol": "grpc",
 	})
 	return resp, err
 }
+
+// grpcRequestIDMiddleware takes the request ID from metadata or generates one
+// and returns it in the response header.
+func grpcRequestIDMiddleware(
+	ctx context.Context,
+	req interface{},
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestid.Header); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	id = requestid.Accept(id)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestid.Header, id))
+	return handler(requestid.NewContext(ctx, id), req)
+}
+
+func grpcMetricsMiddleware(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	grpcRequestDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+	grpcRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	return resp, err
+}
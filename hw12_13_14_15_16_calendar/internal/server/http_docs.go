@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+
+	swaggerFiles "github.com/swaggo/files/v2"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/grpc/pb"
+)
+
+const docsPath = "/api/docs/"
+
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "./openapi.json",
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+// docsHandler serves the embedded OpenAPI spec and a Swagger UI pointing to it.
+func docsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET "+docsPath, http.StripPrefix(docsPath, http.FileServerFS(swaggerFiles.FS)))
+	mux.HandleFunc("GET "+docsPath+"openapi.json", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(pb.OpenAPISpec)
+	})
+	mux.HandleFunc("GET "+docsPath+"swagger-initializer.js", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		_, _ = w.Write([]byte(swaggerInitializer))
+	})
+	mux.Handle("GET /api/docs", http.RedirectHandler(docsPath, http.StatusMovedPermanently))
+	return mux
+}
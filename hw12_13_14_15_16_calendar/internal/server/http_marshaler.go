@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/grpc/pb"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// updateMaskMarshaler derives UpdateEventRequest.updateMask from the keys of a PATCH body,
+// so a field sent as null is cleared instead of being ignored.
+type updateMaskMarshaler struct {
+	runtime.Marshaler
+}
+
+func (m updateMaskMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v any) error {
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if len(body) == 0 {
+			return io.EOF
+		}
+		if err = m.Unmarshal(body, v); err != nil {
+			return err
+		}
+		rq, ok := v.(*pb.UpdateEventRequest)
+		if !ok || len(rq.GetUpdateMask().GetPaths()) > 0 {
+			return nil
+		}
+		rq.UpdateMask, err = updateMaskFromBody(body, rq)
+		return err
+	})
+}
+
+func updateMaskFromBody(body []byte, rq *pb.UpdateEventRequest) (*fieldmaskpb.FieldMask, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil, fmt.Errorf("parse update body : %w", err)
+	}
+	fields := rq.ProtoReflect().Descriptor().Fields()
+	paths := make([]string, 0, len(keys))
+	for key := range keys {
+		fd := fields.ByJSONName(key)
+		if fd == nil {
+			fd = fields.ByName(protoreflect.Name(key))
+		}
+		if fd == nil || fd.Name() == "id" || fd.Name() == "updateMask" {
+			continue
+		}
+		paths = append(paths, string(fd.Name()))
+	}
+	sort.Strings(paths)
+	return &fieldmaskpb.FieldMask{Paths: paths}, nil
+}
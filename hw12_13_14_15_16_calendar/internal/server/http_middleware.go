@@ -1,20 +1,35 @@
 package server
 
 import (
+	"context"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/requestid"
 	"github.com/urfave/negroni"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// unmatchedRoute labels requests that were not served by a gateway route,
+// raw paths are not used as labels to keep metrics cardinality bounded.
+const unmatchedRoute = "other"
+
+var patternWildcard = regexp.MustCompile(`=\*}`)
+
+type routeKey struct{}
+
 func httpLoggingMiddleware(h http.Handler, lg Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		lrw := negroni.NewResponseWriter(w)
 		h.ServeHTTP(lrw, r)
 		latency := time.Since(start)
-		lg.InfoWithParams("", map[string]string{
+		lg.AccessCtx(r.Context(), "", map[string]string{
 			"protocol": "http",
 			"method":   r.Method,
 			"path":     r.RequestURI,
@@ -24,3 +39,70 @@ func httpLoggingMiddleware(h http.Handler, lg Logger) http.Handler {
 		})
 	})
 }
+
+// httpRequestIDMiddleware takes the request ID from the X-Request-Id header or generates one.
+// The ID is returned in the response and forwarded to the grpc server by the gateway.
+func httpRequestIDMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestid.Accept(r.Header.Get(requestid.Header))
+		r.Header.Set(requestid.Header, id)
+		w.Header().Set(requestid.Header, id)
+		h.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
+
+// incomingHeaderMatcher forwards the request ID to the grpc server next to the default headers.
+func incomingHeaderMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, requestid.Header) {
+		return requestid.Header, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// outgoingHeaderMatcher drops the request ID from grpc response metadata,
+// httpRequestIDMiddleware has already set it.
+func outgoingHeaderMatcher(key string) (string, bool) {
+	if key == requestid.Header {
+		return "", false
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+func httpMetricsMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := unmatchedRoute
+		lrw := negroni.NewResponseWriter(w)
+		h.ServeHTTP(lrw, r.WithContext(context.WithValue(r.Context(), routeKey{}, &route)))
+		httpRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(lrw.Status())).Inc()
+	})
+}
+
+// httpTracingMiddleware starts a server span for API requests, probes, metrics and docs are not traced.
+func httpTracingMiddleware(h http.Handler) http.Handler {
+	return otelhttp.NewHandler(h, "http",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			switch r.URL.Path {
+			case "/healthz", "/readyz", "/metrics":
+				return false
+			}
+			return !strings.HasPrefix(r.URL.Path, "/api/docs")
+		}),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + unmatchedRoute
+		}),
+	)
+}
+
+// recordRoute passes the matched gateway pattern to httpMetricsMiddleware and names the request span after it.
+func recordRoute(next runtime.HandlerFunc) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		route, ok := r.Context().Value(routeKey{}).(*string)
+		if pattern, found := runtime.HTTPPattern(r.Context()); ok && found {
+			*route = patternWildcard.ReplaceAllString(pattern.String(), "}")
+			trace.SpanFromContext(r.Context()).SetName(r.Method + " " + *route)
+		}
+		next(w, r, pathParams)
+	}
+}
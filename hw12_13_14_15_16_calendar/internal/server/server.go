@@ -9,46 +9,68 @@ import (
 	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
-	"github.com/rs/zerolog/log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/grpc/pb"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/certs"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/health"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/protobuf/encoding/protojson"
 )
 
+const healthCheckInterval = 10 * time.Second
+
 type Server struct {
 	sever        *http.Server
 	grpcServer   *grpc.Server
+	grpcHealth   *grpchealth.Server
+	checker      *health.Checker
+	tls          *serverTLS
 	lg           Logger
 	httpEndpoint string
 	grpcEndpoint string
 }
 
 type Logger interface {
+	Info(msg string)
 	InfoWithParams(msg string, params map[string]string)
+	InfoCtx(ctx context.Context, msg string, params map[string]string)
+	AccessCtx(ctx context.Context, msg string, params map[string]string)
+	Error(msg string, err error)
 	Fatal(msg string, err error)
 }
 
 type App struct {
 	eventService pb.EventServiceServer
+	checker      *health.Checker
 }
 
-func NewApp(eventService pb.EventServiceServer) *App {
-	return &App{eventService: eventService}
+func NewApp(eventService pb.EventServiceServer, checker *health.Checker) *App {
+	return &App{eventService: eventService, checker: checker}
 }
 
 func NewServer(app *App, lg Logger, cfg config.Server) *Server {
 	httpEndpoint := fmt.Sprintf("%s:%d", cfg.HTTPHost, cfg.HTTPPort)
 	grpcEndpoint := fmt.Sprintf("%s:%d", cfg.GRPCHost, cfg.GRPCPort)
-	server, err := createHTTPServer(grpcEndpoint, httpEndpoint, lg)
+	serverTLS, err := newServerTLS(cfg.TLS)
+	if err != nil {
+		lg.Fatal("configuring tls error", err)
+	}
+	server, err := createHTTPServer(grpcEndpoint, httpEndpoint, app.checker, serverTLS, lg)
 	if err != nil {
 		lg.Fatal("creating http server error", err)
 	}
-	grpcServer := createGRPCServer(app, lg)
+	grpcServer, grpcHealth := createGRPCServer(app, serverTLS, lg)
 	return &Server{
 		sever:        server,
 		grpcServer:   grpcServer,
+		grpcHealth:   grpcHealth,
+		checker:      app.checker,
+		tls:          serverTLS,
 		httpEndpoint: httpEndpoint,
 		grpcEndpoint: grpcEndpoint,
 		lg:           lg,
@@ -56,8 +78,9 @@ func NewServer(app *App, lg Logger, cfg config.Server) *Server {
 }
 
 func (s *Server) Start(ctx context.Context) {
+	s.tls.watch(ctx, s.lg)
 	go func() {
-		if err := s.sever.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := s.listenHTTP(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			s.lg.Fatal("failed to listen http "+s.sever.Addr, err)
 		}
 	}()
@@ -71,12 +94,40 @@ func (s *Server) Start(ctx context.Context) {
 			s.lg.Fatal("failed to serve grpc server ", err)
 		}
 	}()
-	log.Info().Msg("calendar is running...")
-	<-ctx.Done()
+	s.lg.Info("calendar is running...")
+	s.watchHealth(ctx)
+}
+
+func (s *Server) listenHTTP() error {
+	if s.tls != nil {
+		return s.sever.ListenAndServeTLS("", "")
+	}
+	return s.sever.ListenAndServe()
+}
+
+// watchHealth mirrors readiness checks into the grpc health service until ctx is done.
+func (s *Server) watchHealth(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		if len(s.checker.Ready(ctx)) > 0 {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		s.grpcHealth.SetServingStatus("", status)
+		s.grpcHealth.SetServingStatus(pb.EventService_ServiceDesc.ServiceName, status)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
-func createHTTPServer(grpcServerEndpoint, httpServerEndpoint string, lg Logger) (*http.Server, error) {
-	jsonMarshaler := &runtime.JSONPb{
+func createHTTPServer(
+	grpcServerEndpoint, httpServerEndpoint string, checker *health.Checker, serverTLS *serverTLS, lg Logger,
+) (*http.Server, error) {
+	jsonMarshaler := updateMaskMarshaler{Marshaler: &runtime.JSONPb{
 		MarshalOptions: protojson.MarshalOptions{
 			UseProtoNames:   true,
 			EmitUnpopulated: true,
@@ -84,35 +135,65 @@ func createHTTPServer(grpcServerEndpoint, httpServerEndpoint string, lg Logger)
 		UnmarshalOptions: protojson.UnmarshalOptions{
 			DiscardUnknown: true,
 		},
-	}
+	}}
 
 	mux := runtime.NewServeMux(
 		runtime.WithMarshalerOption(runtime.MIMEWildcard, jsonMarshaler),
+		runtime.WithMiddlewares(recordRoute),
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
 	)
 
-	noCredentials := grpc.WithTransportCredentials(insecure.NewCredentials())
-	opts := []grpc.DialOption{noCredentials}
+	opts := []grpc.DialOption{serverTLS.gatewayCredentials(), grpc.WithStatsHandler(otelgrpc.NewClientHandler())}
 	err := pb.RegisterEventServiceHandlerFromEndpoint(context.Background(), mux, grpcServerEndpoint, opts)
 	if err != nil {
 		return nil, fmt.Errorf("register event service handler : %w", err)
 	}
 
+	docs := docsHandler()
+	handler := http.NewServeMux()
+	handler.Handle("/", mux)
+	handler.Handle("/api/docs", docs)
+	handler.Handle(docsPath, docs)
+	checker.Register(handler)
+	handler.Handle("GET /metrics", promhttp.Handler())
+
+	var h http.Handler = httpLoggingMiddleware(handler, lg)
+	h = httpMetricsMiddleware(h)
+	h = httpRequestIDMiddleware(h)
+	h = httpTracingMiddleware(h)
+
 	srv := &http.Server{
 		Addr:              httpServerEndpoint,
-		Handler:           httpLoggingMiddleware(mux, lg),
+		Handler:           h,
 		ReadHeaderTimeout: time.Second * 10,
 	}
+	if serverTLS != nil {
+		srv.TLSConfig = certs.ServerConfig(serverTLS.listener)
+	}
 	return srv, nil
 }
 
-func createGRPCServer(app *App, lg Logger) *grpc.Server {
+func createGRPCServer(app *App, serverTLS *serverTLS, lg Logger) (*grpc.Server, *grpchealth.Server) {
 	grpcLoggingInterceptor := NewGrpcLoggingInterceptor(lg)
-	s := grpc.NewServer(grpc.UnaryInterceptor(grpcLoggingInterceptor.grpcLoggingMiddleware))
+	opts := append(serverTLS.serverOptions(),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			grpcRequestIDMiddleware,
+			grpcMetricsMiddleware,
+			grpcLoggingInterceptor.grpcLoggingMiddleware,
+		),
+	)
+	s := grpc.NewServer(opts...)
 	pb.RegisterEventServiceServer(s, app.eventService)
-	return s
+	healthServer := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+	reflection.Register(s)
+	return s, healthServer
 }
 
 func (s *Server) Stop(ctx context.Context) error {
+	s.grpcHealth.Shutdown()
 	err := s.sever.Shutdown(ctx)
 	s.grpcServer.GracefulStop()
 	return err
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/certs"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// serverTLS holds the certificates of the listeners and of the gateway connection to the grpc server.
+type serverTLS struct {
+	cfg      config.ServerTLS
+	listener *certs.Reloader
+	gateway  *certs.Reloader
+}
+
+func newServerTLS(cfg config.ServerTLS) (*serverTLS, error) {
+	if !cfg.Enabled {
+		return nil, nil //nolint:nilnil
+	}
+	listener, err := certs.NewReloader(cfg.CertFile, cfg.KeyFile, cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server certificates : %w", err)
+	}
+	gateway, err := certs.NewReloader(cfg.Gateway.CertFile, cfg.Gateway.KeyFile, cfg.Gateway.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("load gateway certificates : %w", err)
+	}
+	return &serverTLS{cfg: cfg, listener: listener, gateway: gateway}, nil
+}
+
+func (t *serverTLS) serverOptions() []grpc.ServerOption {
+	if t == nil {
+		return nil
+	}
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(certs.ServerConfig(t.listener)))}
+}
+
+func (t *serverTLS) gatewayCredentials() grpc.DialOption {
+	if t == nil {
+		return grpc.WithTransportCredentials(insecure.NewCredentials())
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(certs.ClientConfig(t.gateway, t.cfg.Gateway.ServerName)))
+}
+
+// watch reloads certificates changed on disk until ctx is done.
+func (t *serverTLS) watch(ctx context.Context, lg Logger) {
+	if t == nil {
+		return
+	}
+	for name, r := range map[string]*certs.Reloader{"server": t.listener, "gateway": t.gateway} {
+		go r.Watch(ctx, t.cfg.ReloadInterval, func(err error) {
+			if err != nil {
+				lg.Error("failed to reload "+name+" certificates", err)
+				return
+			}
+			lg.InfoWithParams("certificates reloaded", map[string]string{"certificates": name})
+		})
+	}
+}
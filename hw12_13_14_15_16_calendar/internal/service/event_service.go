@@ -8,9 +8,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/grpc/pb"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
-	sqlstorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/sql"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 type EventService struct {
@@ -24,22 +24,21 @@ type Storage interface {
 	Create(ctx context.Context, event storage.Event) error
 	GetEventsByUserID(ctx context.Context, userID uuid.UUID) ([]storage.Event, error)
 	GetByID(ctx context.Context, eventID uuid.UUID) (storage.Event, error)
-	Update(ctx context.Context, event storage.Event) error
+	Update(ctx context.Context, event storage.Event, fields ...storage.Field) error
 	Delete(ctx context.Context, eventID uuid.UUID) error
+	WithTx(ctx context.Context, fn func(tx storage.Repository) error) error
 }
 
 type Logger interface {
-	ErrorWithAny(msg string, name string, param any)
-	ErrorWithParams(msg string, params map[string]string, err error)
-	Error(msg string, err error)
-	InfoWithParams(msg string, params map[string]string)
-	Info(msg string)
+	InfoCtx(ctx context.Context, msg string, params map[string]string)
+	ErrorCtx(ctx context.Context, msg string, params map[string]string, err error)
 }
 
 type EventMapper interface {
 	CreateEventRequestToEvent(rq *pb.CreateEventRequest) *storage.Event
 	StorageEventToEvent(event storage.Event) *pb.Event
 	UpdateEventRequestToEvent(rq *pb.UpdateEventRequest) storage.Event
+	UpdateMaskToFields(mask *fieldmaskpb.FieldMask) ([]storage.Field, error)
 }
 
 func NewEventService(eventStorage Storage, lg Logger, eventMapper EventMapper) pb.EventServiceServer {
@@ -52,7 +51,7 @@ func NewEventService(eventStorage Storage, lg Logger, eventMapper EventMapper) p
 
 func (e EventService) CreateEvent(ctx context.Context, rq *pb.CreateEventRequest) (*pb.CreateEventResponse, error) {
 	requestEvent := rq.Event
-	e.lg.InfoWithParams("create event request", map[string]string{
+	e.lg.InfoCtx(ctx, "create event request", map[string]string{
 		"userId":  requestEvent.GetUserId(),
 		"title":   requestEvent.GetTitle(),
 		"eventId": requestEvent.GetId(),
@@ -60,21 +59,26 @@ func (e EventService) CreateEvent(ctx context.Context, rq *pb.CreateEventRequest
 	})
 	err := validateEvent(requestEvent)
 	if err != nil {
-		e.lg.ErrorWithAny("validation failed", "event", requestEvent)
+		e.lg.ErrorCtx(ctx, "validation failed", map[string]string{
+			"eventId":     requestEvent.GetId(),
+			"userId":      requestEvent.GetUserId(),
+			"title":       requestEvent.GetTitle(),
+			"description": requestEvent.GetDescription(),
+		}, err)
 		return nil, err
 	}
 	event := e.eventMapper.CreateEventRequestToEvent(rq)
 	for {
 		err = e.eventStorage.Create(ctx, *event)
 		if err != nil {
-			if errors.Is(err, sqlstorage.ErrEventIDAlreadyExist) {
-				e.lg.InfoWithParams("event id already exists, generating new id", map[string]string{
+			if errors.Is(err, storage.ErrEventIDAlreadyExist) {
+				e.lg.InfoCtx(ctx, "event id already exists, generating new id", map[string]string{
 					"oldEventId": event.ID.String(),
 				})
 				event.ID = uuid.New()
 				continue
 			}
-			e.lg.ErrorWithParams("failed to create event", map[string]string{
+			e.lg.ErrorCtx(ctx, "failed to create event", map[string]string{
 				"eventId": event.ID.String(),
 				"userId":  requestEvent.GetUserId(),
 			}, err)
@@ -82,7 +86,7 @@ func (e EventService) CreateEvent(ctx context.Context, rq *pb.CreateEventRequest
 		}
 		break
 	}
-	e.lg.InfoWithParams("event created successfully", map[string]string{
+	e.lg.InfoCtx(ctx, "event created successfully", map[string]string{
 		"eventId": event.ID.String(),
 		"userId":  requestEvent.GetUserId(),
 		"title":   requestEvent.GetTitle(),
@@ -92,30 +96,30 @@ func (e EventService) CreateEvent(ctx context.Context, rq *pb.CreateEventRequest
 
 func (e EventService) GetEventsByUserID(ctx context.Context, rq *pb.GetByUserIdRequest) (*pb.EventsResponse, error) {
 	requestUserID := rq.GetUserId()
-	e.lg.InfoWithParams("get events by user id request", map[string]string{
+	e.lg.InfoCtx(ctx, "get events by user id request", map[string]string{
 		"userId": requestUserID,
 		"method": "GetEventsByUserID",
 	})
 	if requestUserID == "" {
-		e.lg.Error("missing required field: userId", nil)
+		e.lg.ErrorCtx(ctx, "missing required field: userId", nil, nil)
 		return nil, status.Error(codes.InvalidArgument, "rq missing required field: userId")
 	}
 	id, err := uuid.Parse(requestUserID)
 	if err != nil {
-		e.lg.ErrorWithParams("invalid userId format", map[string]string{
+		e.lg.ErrorCtx(ctx, "invalid userId format", map[string]string{
 			"userId": requestUserID,
 		}, err)
 		return nil, status.Error(codes.InvalidArgument, "invalid userId")
 	}
 	events, err := e.eventStorage.GetEventsByUserID(ctx, id)
 	if err != nil {
-		e.lg.ErrorWithParams("failed to get events by user id", map[string]string{
+		e.lg.ErrorCtx(ctx, "failed to get events by user id", map[string]string{
 			"userId": requestUserID,
 		}, err)
 		return nil, status.Error(codes.Internal, "failed to get event by userId")
 	}
 	if len(events) == 0 {
-		e.lg.InfoWithParams("no events found for user", map[string]string{
+		e.lg.InfoCtx(ctx, "no events found for user", map[string]string{
 			"userId": requestUserID,
 		})
 		return &pb.EventsResponse{Events: make([]*pb.Event, 0)}, nil
@@ -124,7 +128,7 @@ func (e EventService) GetEventsByUserID(ctx context.Context, rq *pb.GetByUserIdR
 	for _, v := range events {
 		res = append(res, e.eventMapper.StorageEventToEvent(v))
 	}
-	e.lg.InfoWithParams("events retrieved successfully", map[string]string{
+	e.lg.InfoCtx(ctx, "events retrieved successfully", map[string]string{
 		"userId":      requestUserID,
 		"eventsCount": strconv.Itoa(len(res)),
 	})
@@ -133,17 +137,17 @@ func (e EventService) GetEventsByUserID(ctx context.Context, rq *pb.GetByUserIdR
 
 func (e EventService) GetById(ctx context.Context, request *pb.ByIdRequest) (*pb.EventResponse, error) { //nolint
 	requestEventID := request.GetEventId()
-	e.lg.InfoWithParams("get event by id request", map[string]string{
+	e.lg.InfoCtx(ctx, "get event by id request", map[string]string{
 		"eventId": requestEventID,
 		"method":  "GetById",
 	})
 	if requestEventID == "" {
-		e.lg.Error("missing required field: eventId", nil)
+		e.lg.ErrorCtx(ctx, "missing required field: eventId", nil, nil)
 		return nil, status.Error(codes.InvalidArgument, "request missing required field: eventId")
 	}
 	id, err := uuid.Parse(requestEventID)
 	if err != nil {
-		e.lg.ErrorWithParams("invalid eventId format", map[string]string{
+		e.lg.ErrorCtx(ctx, "invalid eventId format", map[string]string{
 			"eventId": requestEventID,
 		}, err)
 		return nil, status.Error(codes.InvalidArgument, "invalid eventId")
@@ -151,18 +155,18 @@ func (e EventService) GetById(ctx context.Context, request *pb.ByIdRequest) (*pb
 	event, err := e.eventStorage.GetByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, storage.ErrEventNotFoundErr) {
-			e.lg.InfoWithParams("event not found", map[string]string{
+			e.lg.InfoCtx(ctx, "event not found", map[string]string{
 				"eventId": requestEventID,
 			})
 			return &pb.EventResponse{}, nil
 		}
-		e.lg.ErrorWithParams("failed to get event by id", map[string]string{
+		e.lg.ErrorCtx(ctx, "failed to get event by id", map[string]string{
 			"eventId": requestEventID,
 		}, err)
 		return nil, status.Error(codes.Internal, "failed to get event by userId")
 	}
 	response := e.eventMapper.StorageEventToEvent(event)
-	e.lg.InfoWithParams("event retrieved successfully", map[string]string{
+	e.lg.InfoCtx(ctx, "event retrieved successfully", map[string]string{
 		"eventId": requestEventID,
 		"userId":  response.GetUserId(),
 	})
@@ -171,38 +175,52 @@ func (e EventService) GetById(ctx context.Context, request *pb.ByIdRequest) (*pb
 
 func (e EventService) UpdateEvent(ctx context.Context, request *pb.UpdateEventRequest) (*pb.EventResponse, error) {
 	requestID := request.GetId()
-	e.lg.InfoWithParams("update event request", map[string]string{
+	e.lg.InfoCtx(ctx, "update event request", map[string]string{
 		"eventId": requestID,
 		"method":  "UpdateEvent",
 	})
 	if requestID == "" {
-		e.lg.Error("missing required field: id", nil)
+		e.lg.ErrorCtx(ctx, "missing required field: id", nil, nil)
 		return nil, status.Error(codes.InvalidArgument, "request missing required field: id")
 	}
 	id, err := uuid.Parse(requestID)
 	if err != nil {
-		e.lg.ErrorWithParams("invalid id format", map[string]string{
+		e.lg.ErrorCtx(ctx, "invalid id format", map[string]string{
 			"eventId": requestID,
 		}, err)
 		return nil, status.Error(codes.InvalidArgument, "invalid id")
 	}
-	event := e.eventMapper.UpdateEventRequestToEvent(request)
-	err = e.eventStorage.Update(ctx, event)
+	fields, err := e.eventMapper.UpdateMaskToFields(request.GetUpdateMask())
 	if err != nil {
-		e.lg.ErrorWithParams("failed to update event", map[string]string{
+		e.lg.ErrorCtx(ctx, "invalid update mask", map[string]string{
 			"eventId": requestID,
 		}, err)
-		return nil, status.Error(codes.Internal, "failed to update event")
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
-	updatedEvent, err := e.eventStorage.GetByID(ctx, id)
+	event := e.eventMapper.UpdateEventRequestToEvent(request)
+	var updatedEvent storage.Event
+	// The event is read in the same transaction, so the response has exactly this update.
+	err = e.eventStorage.WithTx(ctx, func(tx storage.Repository) error {
+		if err := tx.Update(ctx, event, fields...); err != nil {
+			return err
+		}
+		updatedEvent, err = tx.GetByID(ctx, id)
+		return err
+	})
 	if err != nil {
-		e.lg.ErrorWithParams("failed to get updated event", map[string]string{
+		e.lg.ErrorCtx(ctx, "failed to update event", map[string]string{
 			"eventId": requestID,
 		}, err)
-		return nil, status.Error(codes.Internal, "failed to get updated event")
+		if errors.Is(err, storage.ErrFieldNotNullable) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, storage.ErrEventNotFoundErr) {
+			return nil, status.Error(codes.NotFound, "event not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to update event")
 	}
 	response := e.eventMapper.StorageEventToEvent(updatedEvent)
-	e.lg.InfoWithParams("event updated successfully", map[string]string{
+	e.lg.InfoCtx(ctx, "event updated successfully", map[string]string{
 		"eventId": requestID,
 		"userId":  response.GetUserId(),
 	})
@@ -211,29 +229,32 @@ func (e EventService) UpdateEvent(ctx context.Context, request *pb.UpdateEventRe
 
 func (e EventService) DeleteEvent(ctx context.Context, request *pb.ByIdRequest) (*pb.DeleteEventResponse, error) {
 	requestEventID := request.GetEventId()
-	e.lg.InfoWithParams("delete event request", map[string]string{
+	e.lg.InfoCtx(ctx, "delete event request", map[string]string{
 		"eventId": requestEventID,
 		"method":  "DeleteEvent",
 	})
 	if requestEventID == "" {
-		e.lg.Error("missing required field: eventId", nil)
+		e.lg.ErrorCtx(ctx, "missing required field: eventId", nil, nil)
 		return nil, status.Error(codes.InvalidArgument, "request missing required field: eventId")
 	}
 	id, err := uuid.Parse(requestEventID)
 	if err != nil {
-		e.lg.ErrorWithParams("invalid eventId format", map[string]string{
+		e.lg.ErrorCtx(ctx, "invalid eventId format", map[string]string{
 			"eventId": requestEventID,
 		}, err)
 		return nil, status.Error(codes.InvalidArgument, "invalid eventId")
 	}
 	err = e.eventStorage.Delete(ctx, id)
 	if err != nil {
-		e.lg.ErrorWithParams("failed to delete event", map[string]string{
+		e.lg.ErrorCtx(ctx, "failed to delete event", map[string]string{
 			"eventId": requestEventID,
 		}, err)
+		if errors.Is(err, storage.ErrEventNotFoundErr) {
+			return nil, status.Error(codes.NotFound, "event not found")
+		}
 		return nil, status.Error(codes.Internal, "failed to delete by eventId")
 	}
-	e.lg.InfoWithParams("event deleted successfully", map[string]string{
+	e.lg.InfoCtx(ctx, "event deleted successfully", map[string]string{
 		"eventId": requestEventID,
 	})
 	return &pb.DeleteEventResponse{}, nil
@@ -0,0 +1,57 @@
+// Package backend opens the storage backend selected by the db config.
+package backend
+
+import (
+	"context"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/memory"
+	sqlstorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/sql"
+	sqlitestorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/sqlite"
+)
+
+const memory = "memory"
+
+// Pinger is implemented by backends that hold a database connection.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Name returns the name of the backend selected by cfg, it is used for logs and health checks.
+func Name(cfg config.DBConf) string {
+	if cfg.InMemory {
+		return memory
+	}
+	return cfg.Driver
+}
+
+// Logger reports problems of the backends that happen in the background, like failed snapshots or retries.
+type Logger interface {
+	memorystorage.Logger
+	sqlstorage.Logger
+}
+
+// New opens the backend selected by cfg, the config is expected to be validated.
+// Backends that implement io.Closer must be closed on shutdown.
+func New(ctx context.Context, cfg config.DBConf, lg Logger) (storage.Storage, error) {
+	switch Name(cfg) {
+	case memory:
+		if cfg.Persistence.Enabled {
+			return memorystorage.Open(cfg.Persistence, lg)
+		}
+		return memorystorage.New(), nil
+	case config.DBDriverSQLite:
+		s := sqlitestorage.New(cfg.Path)
+		if err := s.Connect(ctx); err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		s := sqlstorage.New(cfg.CollectDsn(), cfg, lg)
+		if err := s.Connect(ctx); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+}
@@ -0,0 +1,34 @@
+package cachestorage
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	hits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "cache",
+		Name:      "hits_total",
+		Help:      "Number of events read by id from the cache.",
+	})
+
+	misses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "cache",
+		Name:      "misses_total",
+		Help:      "Number of events read by id from the storage.",
+	})
+
+	invalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "calendar",
+		Subsystem: "cache",
+		Name:      "invalidations_total",
+		Help:      "Number of cached events dropped after a change.",
+	}, []string{"source"})
+)
+
+const (
+	sourceLocal  = "local"
+	sourceRemote = "remote"
+)
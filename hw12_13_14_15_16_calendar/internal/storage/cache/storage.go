@@ -0,0 +1,159 @@
+// Package cachestorage caches events read by id in front of another storage.
+package cachestorage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/cache"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Listener is implemented by backends shared between replicas, it reports the events changed by any of them.
+type Listener interface {
+	ListenChanges(ctx context.Context, changed func(uuid.UUID), reset func())
+}
+
+// Storage reads events by id through an LRU cache. Changes made through it drop the cached event,
+// changes made by other processes are dropped by Listen or expire after the TTL.
+type Storage struct {
+	storage.Storage
+	cache *cache.LRU[uuid.UUID, storage.Event]
+}
+
+func New(next storage.Storage, cfg config.CacheConf) *Storage {
+	return &Storage{
+		Storage: next,
+		cache:   cache.New[uuid.UUID, storage.Event](cfg.Size, cfg.TTL),
+	}
+}
+
+func (s *Storage) GetByID(ctx context.Context, eventID uuid.UUID) (storage.Event, error) {
+	if e, ok := s.cache.Get(eventID); ok {
+		hits.Inc()
+		return e, nil
+	}
+	misses.Inc()
+	// A read started before an invalidation is not cached.
+	generation := s.cache.Generation()
+	e, err := s.Storage.GetByID(ctx, eventID)
+	if err != nil {
+		return e, err
+	}
+	s.cache.SetIfUnchanged(eventID, e, generation)
+	return e, nil
+}
+
+func (s *Storage) Update(ctx context.Context, event storage.Event, fields ...storage.Field) error {
+	defer s.invalidate(event.ID, sourceLocal)
+	return s.Storage.Update(ctx, event, fields...)
+}
+
+func (s *Storage) Delete(ctx context.Context, eventID uuid.UUID) error {
+	defer s.invalidate(eventID, sourceLocal)
+	return s.Storage.Delete(ctx, eventID)
+}
+
+func (s *Storage) DeleteByIDs(ctx context.Context, eventIDs []uuid.UUID) (int, error) {
+	defer func() {
+		for _, id := range eventIDs {
+			s.invalidate(id, sourceLocal)
+		}
+	}()
+	return s.Storage.DeleteByIDs(ctx, eventIDs)
+}
+
+func (s *Storage) ExpireNotifications(ctx context.Context, dateTime time.Time) ([]uuid.UUID, error) {
+	expired, err := s.Storage.ExpireNotifications(ctx, dateTime)
+	for _, id := range expired {
+		s.invalidate(id, sourceLocal)
+	}
+	return expired, err
+}
+
+func (s *Storage) ReleaseClaims(ctx context.Context, claimedBefore time.Time) ([]uuid.UUID, error) {
+	released, err := s.Storage.ReleaseClaims(ctx, claimedBefore)
+	for _, id := range released {
+		s.invalidate(id, sourceLocal)
+	}
+	return released, err
+}
+
+// WithTx drops the events changed by fn once the transaction is over. Reads inside fn bypass the cache.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx storage.Repository) error) error {
+	tx := &trackedTx{}
+	defer func() {
+		for _, id := range tx.changed {
+			s.invalidate(id, sourceLocal)
+		}
+	}()
+	return s.Storage.WithTx(ctx, func(r storage.Repository) error {
+		tx.Repository = r
+		return fn(tx)
+	})
+}
+
+// Listen keeps the cache consistent with the changes of other replicas until ctx is done,
+// when the backend is not shared it only waits for ctx.
+func (s *Storage) Listen(ctx context.Context) {
+	l, ok := s.Storage.(Listener)
+	if !ok {
+		<-ctx.Done()
+		return
+	}
+	l.ListenChanges(ctx, func(id uuid.UUID) {
+		s.invalidate(id, sourceRemote)
+	}, s.reset)
+}
+
+func (s *Storage) invalidate(eventID uuid.UUID, source string) {
+	s.cache.Remove(eventID)
+	invalidations.WithLabelValues(source).Inc()
+}
+
+func (s *Storage) reset() {
+	s.cache.Clear()
+}
+
+// trackedTx records the events changed in a transaction, a retried transaction adds to the same list.
+type trackedTx struct {
+	storage.Repository
+	mu      sync.Mutex
+	changed []uuid.UUID
+}
+
+func (t *trackedTx) track(eventIDs ...uuid.UUID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.changed = append(t.changed, eventIDs...)
+}
+
+func (t *trackedTx) Update(ctx context.Context, event storage.Event, fields ...storage.Field) error {
+	t.track(event.ID)
+	return t.Repository.Update(ctx, event, fields...)
+}
+
+func (t *trackedTx) Delete(ctx context.Context, eventID uuid.UUID) error {
+	t.track(eventID)
+	return t.Repository.Delete(ctx, eventID)
+}
+
+func (t *trackedTx) DeleteByIDs(ctx context.Context, eventIDs []uuid.UUID) (int, error) {
+	t.track(eventIDs...)
+	return t.Repository.DeleteByIDs(ctx, eventIDs)
+}
+
+func (t *trackedTx) ExpireNotifications(ctx context.Context, dateTime time.Time) ([]uuid.UUID, error) {
+	expired, err := t.Repository.ExpireNotifications(ctx, dateTime)
+	t.track(expired...)
+	return expired, err
+}
+
+func (t *trackedTx) ReleaseClaims(ctx context.Context, claimedBefore time.Time) ([]uuid.UUID, error) {
+	released, err := t.Repository.ReleaseClaims(ctx, claimedBefore)
+	t.track(released...)
+	return released, err
+}
@@ -0,0 +1,120 @@
+package cachestorage
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/storagetest"
+)
+
+var cacheConf = config.CacheConf{Enabled: true, Size: 100, TTL: time.Minute}
+
+// countingStorage counts the reads by id that reach the storage.
+type countingStorage struct {
+	storage.Storage
+	reads atomic.Int32
+}
+
+func (s *countingStorage) GetByID(ctx context.Context, eventID uuid.UUID) (storage.Event, error) {
+	s.reads.Add(1)
+	return s.Storage.GetByID(ctx, eventID)
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(*testing.T) storage.Storage {
+		return New(memorystorage.New(), cacheConf)
+	})
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	next := &countingStorage{Storage: memorystorage.New()}
+	s := New(next, cacheConf)
+	event := storagetest.NewEvent()
+	require.NoError(t, s.Create(ctx, event))
+
+	get := func() storage.Event {
+		t.Helper()
+		e, err := s.GetByID(ctx, event.ID)
+		require.NoError(t, err)
+		return e
+	}
+
+	t.Run("reads through", func(t *testing.T) {
+		get()
+		get()
+		require.Equal(t, int32(1), next.reads.Load())
+	})
+
+	t.Run("update invalidates", func(t *testing.T) {
+		title := "updated"
+		require.NoError(t, s.Update(ctx, storage.Event{ID: event.ID, Title: &title}))
+		require.Equal(t, title, *get().Title)
+		require.Equal(t, int32(2), next.reads.Load())
+	})
+
+	t.Run("transaction invalidates", func(t *testing.T) {
+		title := "in transaction"
+		require.NoError(t, s.WithTx(ctx, func(tx storage.Repository) error {
+			return tx.Update(ctx, storage.Event{ID: event.ID, Title: &title})
+		}))
+		require.Equal(t, title, *get().Title)
+	})
+
+	t.Run("remote change invalidates", func(t *testing.T) {
+		title := "changed by another replica"
+		require.NoError(t, next.Update(ctx, storage.Event{ID: event.ID, Title: &title}))
+		require.NotEqual(t, title, *get().Title)
+
+		s.invalidate(event.ID, sourceRemote)
+		require.Equal(t, title, *get().Title)
+	})
+
+	t.Run("delete invalidates", func(t *testing.T) {
+		require.NoError(t, s.Delete(ctx, event.ID))
+		_, err := s.GetByID(ctx, event.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFoundErr)
+	})
+}
+
+// racingStorage changes the event while it is being read, like a concurrent update would.
+type racingStorage struct {
+	storage.Storage
+	during func()
+}
+
+func (s *racingStorage) GetByID(ctx context.Context, eventID uuid.UUID) (storage.Event, error) {
+	e, err := s.Storage.GetByID(ctx, eventID)
+	if s.during != nil {
+		s.during()
+	}
+	return e, err
+}
+
+func TestStaleReadIsNotCached(t *testing.T) {
+	ctx := context.Background()
+	next := &racingStorage{Storage: memorystorage.New()}
+	s := New(next, cacheConf)
+	event := storagetest.NewEvent()
+	require.NoError(t, s.Create(ctx, event))
+
+	title := "updated"
+	next.during = func() {
+		next.during = nil
+		require.NoError(t, s.Update(ctx, storage.Event{ID: event.ID, Title: &title}))
+	}
+	stale, err := s.GetByID(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, *event.Title, *stale.Title)
+
+	got, err := s.GetByID(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, title, *got.Title)
+}
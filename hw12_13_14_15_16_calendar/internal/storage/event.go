@@ -7,7 +7,10 @@ import (
 	"github.com/google/uuid"
 )
 
-var ErrEventNotFoundErr = errors.New("event not found")
+var (
+	ErrEventNotFoundErr    = errors.New("event not found")
+	ErrEventIDAlreadyExist = errors.New("event id already exist")
+)
 
 type Event struct {
 	ID                 uuid.UUID      `db:"id"`
@@ -18,4 +21,6 @@ type Event struct {
 	UserID             *uuid.UUID     `db:"user_id"`
 	NotificationTime   *time.Time     `db:"notification_time"`
 	NotificationStatus *string        `db:"notification_status"`
+	// NotificationClaimedAt is set while the scheduler publishes the notification.
+	NotificationClaimedAt *time.Time `db:"notification_claimed_at"`
 }
@@ -0,0 +1,152 @@
+package memorystorage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+)
+
+type Logger interface {
+	Error(msg string, err error)
+}
+
+// persistence is the state of a storage opened with Open.
+type persistence struct {
+	dir        string
+	lg         Logger
+	snapshotMu sync.Mutex
+	stop       chan struct{}
+	done       sync.WaitGroup
+}
+
+// Open restores the storage from the snapshot and write-ahead log in cfg.Dir
+// and keeps them up to date until Close.
+func Open(cfg config.MemoryPersistence, lg Logger) (*Storage, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, err
+	}
+	s := New()
+	snap, err := readSnapshot(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot : %w", err)
+	}
+	for _, e := range snap.Events {
+		s.put(e)
+	}
+
+	seqs, err := segments(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	next := max(snap.Segment, 1)
+	for i, seq := range seqs {
+		path := segmentPath(cfg.Dir, seq)
+		if seq < snap.Segment {
+			// Left over by a crash after the snapshot was written.
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := replaySegment(path, i == len(seqs)-1, s.apply); err != nil {
+			return nil, err
+		}
+		next = seq + 1
+	}
+
+	s.wal, err = openWAL(cfg.Dir, next, cfg.Fsync == config.FsyncAlways)
+	if err != nil {
+		return nil, err
+	}
+	s.dir, s.lg, s.stop = cfg.Dir, lg, make(chan struct{})
+	s.done.Add(1)
+	go s.run(cfg)
+	return s, nil
+}
+
+func (s *Storage) apply(r record) {
+	switch r.Op {
+	case opPut:
+		s.put(*r.Event)
+	case opDelete:
+		s.remove(r.Event.ID)
+	case opBatch:
+		for _, r := range r.Batch {
+			s.apply(r)
+		}
+	}
+}
+
+// log appends a mutation to the write-ahead log before it is applied, it is called with mu locked.
+func (s *Storage) log(r record) error {
+	if s.wal == nil {
+		return nil
+	}
+	return s.wal.append(r)
+}
+
+func (s *Storage) run(cfg config.MemoryPersistence) {
+	defer s.done.Done()
+	snapshots := time.NewTicker(cfg.SnapshotInterval)
+	defer snapshots.Stop()
+	var syncs <-chan time.Time
+	if cfg.Fsync == config.FsyncInterval {
+		t := time.NewTicker(cfg.FsyncInterval)
+		defer t.Stop()
+		syncs = t.C
+	}
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-syncs:
+			if err := s.wal.sync(); err != nil {
+				s.lg.Error("failed to sync write-ahead log", err)
+			}
+		case <-snapshots.C:
+			if err := s.Snapshot(); err != nil {
+				s.lg.Error("failed to write snapshot", err)
+			}
+		}
+	}
+}
+
+// Snapshot compacts the write-ahead log into a snapshot of all events.
+func (s *Storage) Snapshot() error {
+	if s.wal == nil {
+		return nil
+	}
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	s.mu.Lock()
+	events := make([]storage.Event, 0, len(s.evenIDByEvent))
+	for _, e := range s.evenIDByEvent {
+		events = append(events, e)
+	}
+	seq, err := s.wal.rotate()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeSnapshot(s.dir, snapshot{Segment: seq, Events: events}); err != nil {
+		return err
+	}
+	return s.wal.removeBefore(seq)
+}
+
+// Close writes a final snapshot and closes the log, the storage must not be used afterwards.
+func (s *Storage) Close() error {
+	if s.wal == nil {
+		return nil
+	}
+	close(s.stop)
+	s.done.Wait()
+	return errors.Join(s.Snapshot(), s.wal.close())
+}
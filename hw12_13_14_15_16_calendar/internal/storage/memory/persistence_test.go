@@ -0,0 +1,185 @@
+package memorystorage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/storagetest"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Error(msg string, err error) {
+	l.t.Errorf("%s: %s", msg, err)
+}
+
+func persistenceConf(dir string) config.MemoryPersistence {
+	return config.MemoryPersistence{
+		Enabled:          true,
+		Dir:              dir,
+		Fsync:            config.FsyncAlways,
+		SnapshotInterval: time.Hour,
+	}
+}
+
+func open(t *testing.T, dir string) *Storage {
+	t.Helper()
+	s, err := Open(persistenceConf(dir), testLogger{t})
+	require.NoError(t, err)
+	return s
+}
+
+// crash stops the storage without the final snapshot of Close.
+func crash(t *testing.T, s *Storage) {
+	t.Helper()
+	close(s.stop)
+	s.done.Wait()
+	require.NoError(t, s.wal.close())
+}
+
+func TestPersistentConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s := open(t, t.TempDir())
+		t.Cleanup(func() { require.NoError(t, s.Close()) })
+		return s
+	})
+}
+
+func TestRecovery(t *testing.T) {
+	ctx := context.Background()
+	created, updated, deleted := storagetest.NewEvent(), storagetest.NewEvent(), storagetest.NewEvent()
+	title := "updated"
+
+	write := func(t *testing.T, s *Storage) {
+		t.Helper()
+		require.NoError(t, s.Create(ctx, created))
+		require.NoError(t, s.Create(ctx, updated))
+		require.NoError(t, s.Create(ctx, deleted))
+		require.NoError(t, s.Update(ctx, storage.Event{ID: updated.ID, Title: &title}))
+		require.NoError(t, s.Delete(ctx, deleted.ID))
+	}
+	check := func(t *testing.T, s *Storage) {
+		t.Helper()
+		require.Equal(t, *created.Title, *mustGetByID(t, s, created).Title)
+		require.Equal(t, title, *mustGetByID(t, s, updated).Title)
+		_, err := s.GetByID(ctx, deleted.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFoundErr)
+		events, err := s.GetEventsByUserID(ctx, *created.UserID)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+	}
+
+	t.Run("replays the log after a crash", func(t *testing.T) {
+		dir := t.TempDir()
+		s := open(t, dir)
+		write(t, s)
+		crash(t, s)
+
+		s = open(t, dir)
+		defer s.Close()
+		check(t, s)
+	})
+
+	t.Run("restores the snapshot after close", func(t *testing.T) {
+		dir := t.TempDir()
+		s := open(t, dir)
+		write(t, s)
+		require.NoError(t, s.Close())
+
+		seqs, err := segments(dir)
+		require.NoError(t, err)
+		require.Len(t, seqs, 1, "the snapshot compacts the log")
+
+		s = open(t, dir)
+		defer s.Close()
+		check(t, s)
+	})
+
+	t.Run("replays changes made after a snapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		s := open(t, dir)
+		require.NoError(t, s.Create(ctx, created))
+		require.NoError(t, s.Create(ctx, updated))
+		require.NoError(t, s.Create(ctx, deleted))
+		require.NoError(t, s.Snapshot())
+		require.NoError(t, s.Update(ctx, storage.Event{ID: updated.ID, Title: &title}))
+		require.NoError(t, s.Delete(ctx, deleted.ID))
+		crash(t, s)
+
+		s = open(t, dir)
+		defer s.Close()
+		check(t, s)
+	})
+}
+
+func TestTornWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	event := storagetest.NewEvent()
+	s := open(t, dir)
+	require.NoError(t, s.Create(ctx, event))
+	crash(t, s)
+
+	path := segmentPath(dir, s.wal.seq)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`0badc0de {"op":"put","ev`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s = open(t, dir)
+	defer s.Close()
+	mustGetByID(t, s, event)
+	require.NoError(t, s.Create(ctx, storagetest.NewEvent()))
+}
+
+func TestCorruptLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := open(t, dir)
+	require.NoError(t, s.Create(ctx, storagetest.NewEvent()))
+	require.NoError(t, s.Create(ctx, storagetest.NewEvent()))
+	crash(t, s)
+
+	path := segmentPath(dir, s.wal.seq)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[10] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	_, err = Open(persistenceConf(dir), testLogger{t})
+	require.ErrorIs(t, err, ErrCorruptLog)
+}
+
+func mustGetByID(t *testing.T, s *Storage, event storage.Event) storage.Event {
+	t.Helper()
+	got, err := s.GetByID(context.Background(), event.ID)
+	require.NoError(t, err)
+	return got
+}
+
+func TestTxRecovery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	first, second := storagetest.NewEvent(), storagetest.NewEvent()
+	s := open(t, dir)
+	require.NoError(t, s.WithTx(ctx, func(tx storage.Repository) error {
+		if err := tx.Create(ctx, first); err != nil {
+			return err
+		}
+		return tx.Create(ctx, second)
+	}))
+	crash(t, s)
+
+	s = open(t, dir)
+	defer s.Close()
+	mustGetByID(t, s, first)
+	mustGetByID(t, s, second)
+}
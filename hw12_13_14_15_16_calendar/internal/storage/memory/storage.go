@@ -3,87 +3,141 @@ package memorystorage
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
 )
 
+const (
+	statusPending     = "PENDING"
+	statusPendingSent = "PENDING_SENT"
+	statusExpired     = "EXPIRED"
+)
+
 type Storage struct {
 	userIDByEvent map[uuid.UUID][]storage.Event
 	evenIDByEvent map[uuid.UUID]storage.Event
 	mu            sync.RWMutex
+	// wal is nil unless the storage was opened with persistence.
+	wal *wal
+	persistence
 }
 
-func (s *Storage) Update(ctx context.Context, newEvent storage.Event) error {
-	e, err := s.GetByID(ctx, newEvent.ID)
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if err != nil {
-		return err
-	}
-	if newEvent.UserID != nil {
-		e.UserID = newEvent.UserID
-	}
-	if newEvent.Title != nil {
-		e.Title = newEvent.Title
-	}
-	if newEvent.DateTime != nil {
-		e.DateTime = newEvent.DateTime
-	}
-	if newEvent.EventDuration != nil {
-		e.EventDuration = newEvent.EventDuration
+func (s *Storage) Update(ctx context.Context, newEvent storage.Event, fields ...storage.Field) error {
+	return s.WithTx(ctx, func(tx storage.Repository) error {
+		return tx.Update(ctx, newEvent, fields...)
+	})
+}
+
+// put stores the event, replacing an event with the same id.
+func (s *Storage) put(e storage.Event) {
+	old, ok := s.evenIDByEvent[e.ID]
+	s.evenIDByEvent[e.ID] = e
+	if ok && *old.UserID == *e.UserID {
+		events := s.userIDByEvent[*e.UserID]
+		for i, val := range events {
+			if val.ID == e.ID {
+				events[i] = e
+				break
+			}
+		}
+		return
 	}
-	if newEvent.Description != nil {
-		e.Description = newEvent.Description
+	if ok {
+		s.removeUserEvent(*old.UserID, e.ID)
 	}
-	if newEvent.NotificationTime != nil {
-		e.NotificationTime = newEvent.NotificationTime
+	s.userIDByEvent[*e.UserID] = append(s.userIDByEvent[*e.UserID], e)
+}
+
+func (s *Storage) remove(eventID uuid.UUID) {
+	event, ok := s.evenIDByEvent[eventID]
+	if !ok {
+		return
 	}
-	s.evenIDByEvent[e.ID] = e
-	events := s.userIDByEvent[*e.UserID]
+	delete(s.evenIDByEvent, event.ID)
+	s.removeUserEvent(*event.UserID, event.ID)
+}
+
+func (s *Storage) removeUserEvent(userID uuid.UUID, eventID uuid.UUID) {
+	events := s.userIDByEvent[userID]
 	for i, val := range events {
-		if val.ID == e.ID {
-			events[i] = e
+		if val.ID == eventID {
+			events = append(events[:i], events[i+1:]...)
 			break
 		}
 	}
-	return nil
+	if len(events) == 0 {
+		delete(s.userIDByEvent, userID)
+		return
+	}
+	s.userIDByEvent[userID] = events
 }
 
-func (s *Storage) Create(_ context.Context, event storage.Event) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.userIDByEvent[*event.UserID] = append(s.userIDByEvent[*event.UserID], event)
-	s.evenIDByEvent[event.ID] = event
-	return nil
+func (s *Storage) Create(ctx context.Context, event storage.Event) error {
+	return s.WithTx(ctx, func(tx storage.Repository) error {
+		return tx.Create(ctx, event)
+	})
 }
 
 func (s *Storage) Delete(ctx context.Context, eventID uuid.UUID) error {
-	event, err := s.GetByID(ctx, eventID)
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if err != nil {
+	return s.WithTx(ctx, func(tx storage.Repository) error {
+		return tx.Delete(ctx, eventID)
+	})
+}
+
+func (s *Storage) GetEventsByUserID(ctx context.Context, userID uuid.UUID) ([]storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.view().GetEventsByUserID(ctx, userID)
+}
+
+func (s *Storage) GetByID(ctx context.Context, eventID uuid.UUID) (storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.view().GetByID(ctx, eventID)
+}
+
+func (s *Storage) FindDueNotifications(ctx context.Context, from, to time.Time) ([]storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.view().FindDueNotifications(ctx, from, to)
+}
+
+func (s *Storage) ExpireNotifications(ctx context.Context, dateTime time.Time) (expired []uuid.UUID, err error) {
+	err = s.WithTx(ctx, func(tx storage.Repository) error {
+		expired, err = tx.ExpireNotifications(ctx, dateTime)
 		return err
-	}
-	delete(s.evenIDByEvent, event.ID)
-	delete(s.userIDByEvent, *event.UserID)
-	return nil
+	})
+	return expired, err
+}
+
+func (s *Storage) ReleaseClaims(ctx context.Context, claimedBefore time.Time) (released []uuid.UUID, err error) {
+	err = s.WithTx(ctx, func(tx storage.Repository) error {
+		released, err = tx.ReleaseClaims(ctx, claimedBefore)
+		return err
+	})
+	return released, err
 }
 
-func (s *Storage) GetEventsByUserID(_ context.Context, userID uuid.UUID) ([]storage.Event, error) {
+func (s *Storage) FindOlderThan(ctx context.Context, dateTime time.Time, limit int) ([]storage.Event, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.userIDByEvent[userID], nil
+	return s.view().FindOlderThan(ctx, dateTime, limit)
 }
 
-func (s *Storage) GetByID(_ context.Context, eventID uuid.UUID) (storage.Event, error) {
+func (s *Storage) CountOlderThan(ctx context.Context, dateTime time.Time) (int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	event, ok := s.evenIDByEvent[eventID]
-	if !ok {
-		return storage.Event{}, storage.ErrEventNotFoundErr
-	}
-	return event, nil
+	return s.view().CountOlderThan(ctx, dateTime)
+}
+
+func (s *Storage) DeleteByIDs(ctx context.Context, eventIDs []uuid.UUID) (deleted int, err error) {
+	err = s.WithTx(ctx, func(tx storage.Repository) error {
+		deleted, err = tx.DeleteByIDs(ctx, eventIDs)
+		return err
+	})
+	return deleted, err
 }
 
 func New() *Storage {
@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/storagetest"
 )
 
 func TestStorage(t *testing.T) {
@@ -122,6 +123,44 @@ func TestStorage(t *testing.T) {
 			assert.Equal(t, *event.EventDuration, *updatedEvent.EventDuration)
 			assert.Equal(t, *event.NotificationTime, *updatedEvent.NotificationTime)
 		})
+
+		t.Run("clear nullable fields by mask", func(t *testing.T) {
+			event := createEvent()
+			ms := New()
+			_ = ms.Create(context.Background(), event)
+
+			newTitle := "title from mask"
+			err := ms.Update(context.Background(), storage.Event{
+				ID:    event.ID,
+				Title: &newTitle,
+			}, storage.FieldTitle, storage.FieldDescription, storage.FieldNotificationTime)
+			assert.NoError(t, err)
+			updatedEvent, err := ms.GetByID(context.Background(), event.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, newTitle, *updatedEvent.Title)
+			assert.Nil(t, updatedEvent.Description)
+			assert.Nil(t, updatedEvent.NotificationTime)
+			assert.Nil(t, updatedEvent.NotificationStatus)
+			assert.Equal(t, *event.DateTime, *updatedEvent.DateTime)
+		})
+
+		t.Run("mask with not nullable field", func(t *testing.T) {
+			event := createEvent()
+			ms := New()
+			_ = ms.Create(context.Background(), event)
+
+			err := ms.Update(context.Background(), storage.Event{ID: event.ID}, storage.FieldTitle)
+			assert.ErrorIs(t, err, storage.ErrFieldNotNullable)
+			updatedEvent, err := ms.GetByID(context.Background(), event.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, *event.Title, *updatedEvent.Title)
+		})
+	})
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(*testing.T) storage.Storage {
+		return New()
 	})
 }
 
@@ -133,14 +172,17 @@ func createEvent() storage.Event {
 	now := time.Now()
 	nTime := time.Now()
 	duration, _ := time.ParseDuration("1h")
+	// Create marks events with a notification time as pending.
+	status := "PENDING"
 	event := storage.Event{
-		ID:               id,
-		Title:            &title,
-		DateTime:         &now,
-		EventDuration:    &duration,
-		Description:      &description,
-		UserID:           &userID,
-		NotificationTime: &nTime,
+		ID:                 id,
+		Title:              &title,
+		DateTime:           &now,
+		EventDuration:      &duration,
+		Description:        &description,
+		UserID:             &userID,
+		NotificationTime:   &nTime,
+		NotificationStatus: &status,
 	}
 	return event
 }
@@ -0,0 +1,236 @@
+package memorystorage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+)
+
+// WithTx runs fn holding the write lock, so units of work run one at a time. The changes of fn
+// are kept aside and applied, with a single log record, only when it succeeds.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx storage.Repository) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := &tx{s: s, pending: make(map[uuid.UUID]*storage.Event)}
+	if err := fn(t); err != nil {
+		return err
+	}
+	return t.commit()
+}
+
+// view reads the storage without changes, it is used with mu locked.
+func (s *Storage) view() *tx {
+	return &tx{s: s}
+}
+
+// tx is a unit of work over the storage. pending holds the changed events by id,
+// nil for a deleted one, and order the ids in the order they were first changed.
+type tx struct {
+	s       *Storage
+	pending map[uuid.UUID]*storage.Event
+	order   []uuid.UUID
+}
+
+func (t *tx) get(eventID uuid.UUID) (storage.Event, bool) {
+	if e, ok := t.pending[eventID]; ok {
+		if e == nil {
+			return storage.Event{}, false
+		}
+		return *e, true
+	}
+	e, ok := t.s.evenIDByEvent[eventID]
+	return e, ok
+}
+
+func (t *tx) set(eventID uuid.UUID, e *storage.Event) {
+	if _, ok := t.pending[eventID]; !ok {
+		t.order = append(t.order, eventID)
+	}
+	t.pending[eventID] = e
+}
+
+func (t *tx) commit() error {
+	records := make([]record, 0, len(t.order))
+	for _, id := range t.order {
+		if e := t.pending[id]; e != nil {
+			records = append(records, record{Op: opPut, Event: e})
+		} else {
+			records = append(records, record{Op: opDelete, Event: &storage.Event{ID: id}})
+		}
+	}
+	var r record
+	switch len(records) {
+	case 0:
+		return nil
+	case 1:
+		r = records[0]
+	default:
+		r = record{Op: opBatch, Batch: records}
+	}
+	if err := t.s.log(r); err != nil {
+		return err
+	}
+	t.s.apply(r)
+	return nil
+}
+
+func (t *tx) Create(_ context.Context, event storage.Event) error {
+	if event.NotificationTime != nil {
+		status := statusPending
+		event.NotificationStatus = &status
+	}
+	if _, ok := t.get(event.ID); ok {
+		return storage.ErrEventIDAlreadyExist
+	}
+	t.set(event.ID, &event)
+	return nil
+}
+
+func (t *tx) Update(_ context.Context, newEvent storage.Event, fields ...storage.Field) error {
+	changes, err := storage.Changes(newEvent, fields...)
+	if err != nil {
+		return err
+	}
+	e, ok := t.get(newEvent.ID)
+	if !ok {
+		return storage.ErrEventNotFoundErr
+	}
+	e.Apply(changes)
+	t.set(e.ID, &e)
+	return nil
+}
+
+func (t *tx) Delete(_ context.Context, eventID uuid.UUID) error {
+	if _, ok := t.get(eventID); !ok {
+		return storage.ErrEventNotFoundErr
+	}
+	t.set(eventID, nil)
+	return nil
+}
+
+func (t *tx) GetByID(_ context.Context, eventID uuid.UUID) (storage.Event, error) {
+	e, ok := t.get(eventID)
+	if !ok {
+		return storage.Event{}, storage.ErrEventNotFoundErr
+	}
+	return e, nil
+}
+
+// GetEventsByUserID returns a copy of the user events, Update and Delete change the stored slice in place.
+func (t *tx) GetEventsByUserID(_ context.Context, userID uuid.UUID) ([]storage.Event, error) {
+	stored := t.s.userIDByEvent[userID]
+	events := make([]storage.Event, 0, len(stored))
+	for _, e := range stored {
+		if p, ok := t.pending[e.ID]; ok {
+			if p == nil || *p.UserID != userID {
+				continue
+			}
+			e = *p
+		}
+		events = append(events, e)
+	}
+	for _, id := range t.order {
+		p := t.pending[id]
+		if p == nil || *p.UserID != userID {
+			continue
+		}
+		if old, ok := t.s.evenIDByEvent[id]; ok && *old.UserID == userID {
+			continue
+		}
+		events = append(events, *p)
+	}
+	return events, nil
+}
+
+func (t *tx) FindDueNotifications(_ context.Context, from, to time.Time) ([]storage.Event, error) {
+	return t.find(func(e storage.Event) bool {
+		return isPending(e) && !e.NotificationTime.Before(from) && e.NotificationTime.Before(to)
+	}), nil
+}
+
+func (t *tx) ExpireNotifications(_ context.Context, dateTime time.Time) ([]uuid.UUID, error) {
+	events := t.find(func(e storage.Event) bool {
+		return isPending(e) && e.NotificationTime.Before(dateTime)
+	})
+	expired := make([]uuid.UUID, 0, len(events))
+	for _, e := range events {
+		status := statusExpired
+		e.NotificationStatus = &status
+		t.set(e.ID, &e)
+		expired = append(expired, e.ID)
+	}
+	return expired, nil
+}
+
+func (t *tx) ReleaseClaims(_ context.Context, claimedBefore time.Time) ([]uuid.UUID, error) {
+	events := t.find(func(e storage.Event) bool {
+		return e.NotificationStatus != nil && *e.NotificationStatus == statusPendingSent &&
+			e.NotificationClaimedAt != nil && e.NotificationClaimedAt.Before(claimedBefore)
+	})
+	released := make([]uuid.UUID, 0, len(events))
+	for _, e := range events {
+		status := statusPending
+		e.NotificationStatus = &status
+		e.NotificationClaimedAt = nil
+		t.set(e.ID, &e)
+		released = append(released, e.ID)
+	}
+	return released, nil
+}
+
+func isPending(e storage.Event) bool {
+	return e.NotificationStatus != nil && *e.NotificationStatus == statusPending && e.NotificationTime != nil
+}
+
+func (t *tx) FindOlderThan(_ context.Context, dateTime time.Time, limit int) ([]storage.Event, error) {
+	events := t.find(olderThan(dateTime))
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].DateTime.Before(*events[j].DateTime)
+	})
+	return events[:min(limit, len(events))], nil
+}
+
+func (t *tx) CountOlderThan(_ context.Context, dateTime time.Time) (int, error) {
+	return len(t.find(olderThan(dateTime))), nil
+}
+
+func olderThan(dateTime time.Time) func(storage.Event) bool {
+	return func(e storage.Event) bool {
+		return e.DateTime != nil && e.DateTime.Before(dateTime)
+	}
+}
+
+func (t *tx) DeleteByIDs(_ context.Context, eventIDs []uuid.UUID) (int, error) {
+	deleted := 0
+	for _, id := range eventIDs {
+		if _, ok := t.get(id); ok {
+			t.set(id, nil)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (t *tx) find(match func(storage.Event) bool) []storage.Event {
+	events := make([]storage.Event, 0)
+	for id, e := range t.s.evenIDByEvent {
+		if _, ok := t.pending[id]; ok {
+			continue
+		}
+		if match(e) {
+			events = append(events, e)
+		}
+	}
+	for _, id := range t.order {
+		if e := t.pending[id]; e != nil && match(*e) {
+			events = append(events, *e)
+		}
+	}
+	return events
+}
@@ -0,0 +1,181 @@
+package memorystorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+)
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+	opBatch  = "batch"
+
+	segmentPrefix = "wal-"
+	segmentSuffix = ".log"
+)
+
+var ErrCorruptLog = errors.New("corrupt write-ahead log")
+
+// record is a mutation in the write-ahead log. Create and Update store the whole resulting event,
+// so replaying the records in order restores the state. A batch holds the records of a transaction,
+// it is a single line so a torn write drops the transaction as a whole.
+type record struct {
+	Op    string         `json:"op"`
+	Event *storage.Event `json:"event,omitempty"`
+	Batch []record       `json:"batch,omitempty"`
+}
+
+// wal appends records to numbered segment files, a snapshot rotates to a new segment
+// and removes the segments it covers. Every line is a crc32 checksum and the json record.
+type wal struct {
+	mu       sync.Mutex
+	dir      string
+	seq      int
+	f        *os.File
+	syncEach bool
+}
+
+func segmentPath(dir string, seq int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%08d%s", segmentPrefix, seq, segmentSuffix))
+}
+
+// segments lists the sequence numbers of the segments in dir in ascending order.
+func segments(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []int
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix))
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	return seqs, nil
+}
+
+func openWAL(dir string, seq int, syncEach bool) (*wal, error) {
+	f, err := os.OpenFile(segmentPath(dir, seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &wal{dir: dir, seq: seq, f: f, syncEach: syncEach}, nil
+}
+
+func (w *wal) append(r record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line := fmt.Appendf(nil, "%08x %s\n", crc32.ChecksumIEEE(data), data)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.f.Write(line); err != nil {
+		return fmt.Errorf("failed to write log record : %w", err)
+	}
+	if w.syncEach {
+		return w.f.Sync()
+	}
+	return nil
+}
+
+func (w *wal) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Sync()
+}
+
+// rotate finishes the current segment and continues in the next one, it returns the new sequence number.
+func (w *wal) rotate() (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.f.Sync(); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(segmentPath(w.dir, w.seq+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.f.Close(); err != nil {
+		_ = f.Close()
+		return 0, err
+	}
+	w.f = f
+	w.seq++
+	return w.seq, nil
+}
+
+// removeBefore deletes the segments older than seq.
+func (w *wal) removeBefore(seq int) error {
+	seqs, err := segments(w.dir)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, s := range seqs {
+		if s < seq {
+			errs = append(errs, os.Remove(segmentPath(w.dir, s)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return errors.Join(w.f.Sync(), w.f.Close())
+}
+
+// replaySegment applies the records of a segment. A broken record at the end of the last segment
+// is a write cut short by a crash, it is truncated. Any other broken record fails the replay.
+func replaySegment(path string, last bool, apply func(record)) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	for offset < len(data) {
+		end := bytes.IndexByte(data[offset:], '\n')
+		var r record
+		if end < 0 || !decodeRecord(data[offset:offset+end], &r) {
+			if !last || (end >= 0 && offset+end+1 < len(data)) {
+				return fmt.Errorf("%w: %s at offset %d", ErrCorruptLog, path, offset)
+			}
+			return os.Truncate(path, int64(offset))
+		}
+		apply(r)
+		offset += end + 1
+	}
+	return nil
+}
+
+func decodeRecord(line []byte, r *record) bool {
+	checksum, data, ok := bytes.Cut(line, []byte{' '})
+	if !ok {
+		return false
+	}
+	sum, err := strconv.ParseUint(string(checksum), 16, 32)
+	if err != nil || uint32(sum) != crc32.ChecksumIEEE(data) {
+		return false
+	}
+	return json.Unmarshal(data, r) == nil
+}
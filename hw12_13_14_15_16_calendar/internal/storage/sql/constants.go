@@ -1,6 +1,17 @@
 package sqlstorage
 
 const (
-	UniqueViolation         = "23505"
-	ErrParsingToStructError = "error while parsing events to %s: %w"
+	UniqueViolation      = "23505"
+	SerializationFailure = "40001"
+	DeadlockDetected     = "40P01"
+	AdminShutdown        = "57P01"
+	CrashShutdown        = "57P02"
+	CannotConnectNow     = "57P03"
+	// ConnectionExceptionClass starts the codes of lost or refused connections.
+	ConnectionExceptionClass = "08"
+	ErrParsingToStructError  = "error while parsing events to %s: %w"
+
+	statusPending     = "PENDING"
+	statusPendingSent = "PENDING_SENT"
+	statusExpired     = "EXPIRED"
 )
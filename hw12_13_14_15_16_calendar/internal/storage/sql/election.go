@@ -0,0 +1,81 @@
+package sqlstorage
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+// Campaign competes with the other replicas for the leadership of name until ctx is done.
+// The leader holds a session advisory lock on its own connection. Postgres releases the lock
+// when the leader stops or its connection is lost, then another replica takes it within interval.
+// The leader checks its connection every interval and steps down when it fails.
+// leading is called whenever the leadership of this replica changes.
+func (s *Storage) Campaign(ctx context.Context, name string, interval time.Duration, leading func(bool)) {
+	backoff := s.retry.InitialBackoff
+	for {
+		err := s.campaign(ctx, lockKey(name), interval, leading, func() {
+			backoff = s.retry.InitialBackoff
+		})
+		leading(false)
+		if ctx.Err() != nil {
+			return
+		}
+		s.lg.ErrorWithParams("leader election failed, reconnecting", map[string]string{
+			"election": name,
+			"backoff":  backoff.String(),
+		}, err)
+		if sleep(ctx, backoff) != nil {
+			return
+		}
+		backoff = min(2*backoff, s.retry.MaxBackoff)
+	}
+}
+
+func (s *Storage) campaign(
+	ctx context.Context, key int64, interval time.Duration, leading func(bool), connected func(),
+) error {
+	conn, err := s.dial()
+	if err != nil {
+		return err
+	}
+	// Closing the session releases the lock.
+	defer conn.Close()
+	connected()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	leader := false
+	for {
+		if err := s.holdLock(ctx, conn, key, interval, &leader); err != nil {
+			return err
+		}
+		if leader {
+			leading(true)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// holdLock takes the lock unless this replica leads, otherwise it checks that the session is alive.
+func (s *Storage) holdLock(ctx context.Context, conn *pgx.Conn, key int64, timeout time.Duration, leader *bool) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if *leader {
+		return conn.Ping(ctx)
+	}
+	return conn.QueryRowEx(ctx, "SELECT pg_try_advisory_lock($1)", nil, key).Scan(leader)
+}
+
+// lockKey maps the name of an election to an advisory lock key.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("calendar:" + name))
+	return int64(h.Sum64()) //nolint:gosec
+}
@@ -0,0 +1,69 @@
+package sqlstorage
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx"
+)
+
+// EventsChangedChannel is notified with the id of every updated or deleted event, see migration 00005.
+const EventsChangedChannel = "events_changed"
+
+const dialTimeout = 5 * time.Second
+
+// ListenChanges calls changed with the id of every event updated or deleted by any replica until ctx is done.
+// Notifications sent while the connection is down are lost, so reset is called after every connection.
+func (s *Storage) ListenChanges(ctx context.Context, changed func(uuid.UUID), reset func()) {
+	backoff := s.retry.InitialBackoff
+	for {
+		err := s.listen(ctx, changed, func() {
+			backoff = s.retry.InitialBackoff
+			reset()
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		s.lg.ErrorWithParams("events listener failed, reconnecting", map[string]string{
+			"channel": EventsChangedChannel,
+			"backoff": backoff.String(),
+		}, err)
+		if sleep(ctx, backoff) != nil {
+			return
+		}
+		backoff = min(2*backoff, s.retry.MaxBackoff)
+	}
+}
+
+// dial opens a connection outside the pool for a session that outlives single statements.
+func (s *Storage) dial() (*pgx.Conn, error) {
+	cfg, err := pgx.ParseConnectionString(s.dsn)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Dial = (&net.Dialer{Timeout: dialTimeout, KeepAlive: time.Minute}).Dial
+	return pgx.Connect(cfg)
+}
+
+func (s *Storage) listen(ctx context.Context, changed func(uuid.UUID), connected func()) error {
+	conn, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.Listen(EventsChangedChannel); err != nil {
+		return err
+	}
+	connected()
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		if id, err := uuid.Parse(n.Payload); err == nil {
+			changed(id)
+		}
+	}
+}
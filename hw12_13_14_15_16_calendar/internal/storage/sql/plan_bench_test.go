@@ -0,0 +1,137 @@
+//go:build migrations
+// +build migrations
+
+package sqlstorage
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/stdlib"
+	"github.com/jmoiron/sqlx"
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	_ "github.com/timutkin/otus-go/hw12_13_14_15_calendar/migrations"
+)
+
+const (
+	benchDSNEnv  = "CALENDAR_BENCH_DSN"
+	benchRowsEnv = "CALENDAR_BENCH_ROWS"
+)
+
+// recorder keeps the last query run by the storage, so its plan can be checked.
+type recorder struct {
+	sqlx.ExtContext
+	query string
+	args  []any
+}
+
+func (r *recorder) QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error) {
+	r.query, r.args = query, args
+	return r.ExtContext.QueryxContext(ctx, query, args...)
+}
+
+// BenchmarkLookups seeds a local postgres and checks that the scheduler and user lookups use
+// their indexes. CALENDAR_BENCH_DSN must point to a scratch database, its events table is emptied.
+// CALENDAR_BENCH_ROWS sets the number of seeded events, two millions by default:
+//
+//	CALENDAR_BENCH_DSN="host=localhost user=postgres password=postgres dbname=bench sslmode=disable" \
+//		go test -tags migrations -run '^$' -bench Lookups ./internal/storage/sql/
+func BenchmarkLookups(b *testing.B) {
+	dsn := os.Getenv(benchDSNEnv)
+	if dsn == "" {
+		b.Skipf("%s is not set", benchDSNEnv)
+	}
+	rows := 2_000_000
+	if v := os.Getenv(benchRowsEnv); v != "" {
+		var err error
+		rows, err = strconv.Atoi(v)
+		require.NoError(b, err)
+	}
+	ctx := context.Background()
+
+	db, err := goose.OpenDBWithDriver("pgx", dsn)
+	require.NoError(b, err)
+	defer db.Close()
+	require.NoError(b, goose.RunContext(ctx, "up", db, "../../../migrations"))
+	users := seed(ctx, b, sqlx.NewDb(db, "pgx"), rows)
+
+	s := New(dsn, config.DBConf{Tables: config.DBTables{Schema: "public"}, Retry: config.DBRetry{
+		StartupTimeout: time.Second, Attempts: 1, InitialBackoff: time.Second, MaxBackoff: time.Second,
+	}}, testLogger{})
+	require.NoError(b, s.Connect(ctx))
+	defer s.Close()
+	rec := &recorder{ExtContext: s.q}
+	s.q = rec
+
+	lookups := []struct {
+		name  string
+		index string
+		run   func() error
+	}{
+		{"pending notifications", "events_pending_notification_time_idx", func() error {
+			_, err := s.FindDueNotifications(ctx, time.Now().Add(-15*time.Minute), time.Now())
+			return err
+		}},
+		{"events by user", "events_user_id_date_time_idx", func() error {
+			_, err := s.GetEventsByUserID(ctx, users[len(users)/2])
+			return err
+		}},
+		{"old events", "events_date_time_idx", func() error {
+			_, err := s.FindOlderThan(ctx, time.Now().AddDate(-1, 0, 0), 500)
+			return err
+		}},
+	}
+	for _, l := range lookups {
+		b.Run(l.name, func(b *testing.B) {
+			require.NoError(b, l.run())
+			requireIndexScan(ctx, b, s.db, l.index, rec.query, rec.args)
+			for b.Loop() {
+				if err := l.run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// seed fills the events table with a year of events before and after now, a hundred events
+// per user and one pending notification in a thousand, and returns the users.
+func seed(ctx context.Context, b *testing.B, db *sqlx.DB, rows int) []uuid.UUID {
+	b.Helper()
+	_, err := db.ExecContext(ctx, "TRUNCATE events")
+	require.NoError(b, err)
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO events (id, title, date_time, event_duration, user_id, notification_time, notification_status)
+		SELECT gen_random_uuid(),
+			'event ' || i,
+			t,
+			3600000000000,
+			('00000000-0000-0000-0000-' || lpad(to_hex(i % $2), 12, '0'))::uuid,
+			t - INTERVAL '1 hour',
+			(CASE WHEN i % 1000 = 0 THEN 'PENDING' ELSE 'SENT' END)::notification_status
+		FROM generate_series(1, $1) AS i,
+			LATERAL (SELECT NOW() + (i % 1051200 - 525600) * INTERVAL '1 minute') AS d(t)`,
+		rows, max(rows/100, 1))
+	require.NoError(b, err)
+	_, err = db.ExecContext(ctx, "ANALYZE events")
+	require.NoError(b, err)
+
+	var users []uuid.UUID
+	require.NoError(b, db.SelectContext(ctx, &users, "SELECT DISTINCT user_id FROM events LIMIT 100"))
+	require.NotEmpty(b, users)
+	return users
+}
+
+func requireIndexScan(ctx context.Context, b *testing.B, db *sqlx.DB, index, query string, args []any) {
+	b.Helper()
+	var plan []string
+	require.NoError(b, db.SelectContext(ctx, &plan, "EXPLAIN "+query, args...))
+	require.Contains(b, strings.Join(plan, "\n"), index, "query %s does not use the index", query)
+}
@@ -0,0 +1,88 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// waitForDB pings the database until it answers or the startup timeout passes.
+func (s *Storage) waitForDB(ctx context.Context, db *sqlx.DB) error {
+	ctx, cancel := context.WithTimeout(ctx, s.retry.StartupTimeout)
+	defer cancel()
+	backoff := s.retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		s.lg.ErrorWithParams("database is not available, retrying", map[string]string{
+			"attempt": strconv.Itoa(attempt),
+			"backoff": backoff.String(),
+		}, err)
+		if sleep(ctx, backoff) != nil {
+			return fmt.Errorf("gave up after %d attempts : %w", attempt, err)
+		}
+		backoff = min(2*backoff, s.retry.MaxBackoff)
+	}
+}
+
+// withRetry runs an idempotent statement again after a transient error. Inside a transaction
+// the statement runs once, a failed statement aborts the transaction and WithTx retries it as a whole.
+func (s *Storage) withRetry(ctx context.Context, operation string, fn func() error) error {
+	if s.inTx {
+		return fn()
+	}
+	backoff := s.retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !transient(err) || attempt >= s.retry.Attempts {
+			return err
+		}
+		s.lg.ErrorWithParams("transient database error, retrying", map[string]string{
+			"operation": operation,
+			"attempt":   strconv.Itoa(attempt),
+		}, err)
+		if err := sleep(ctx, backoff); err != nil {
+			return err
+		}
+		backoff = min(2*backoff, s.retry.MaxBackoff)
+	}
+}
+
+// sleep waits for d, it returns early with the error of ctx when ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// transient reports errors after which the same statement may succeed: lost connections,
+// a restarting server and conflicts with concurrent transactions.
+func transient(err error) bool {
+	switch code := errorCode(err); {
+	case code == SerializationFailure, code == DeadlockDetected,
+		code == AdminShutdown, code == CrashShutdown, code == CannotConnectNow,
+		strings.HasPrefix(code, ConnectionExceptionClass):
+		return true
+	case code != "":
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.As(err, &netErr)
+}
@@ -0,0 +1,90 @@
+package sqlstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+)
+
+type testLogger struct{}
+
+func (testLogger) ErrorWithParams(string, map[string]string, error) {}
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", pgx.PgError{Code: SerializationFailure}, true},
+		{"admin shutdown", fmt.Errorf("query : %w", pgx.PgError{Code: AdminShutdown}), true},
+		{"connection failure", pgx.PgError{Code: "08006"}, true},
+		{"connection reset", fmt.Errorf("read : %w", syscall.ECONNRESET), true},
+		{"unique violation", pgx.PgError{Code: UniqueViolation}, false},
+		{"other error", errors.New("syntax"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, transient(tt.err))
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	s := New("", config.DBConf{Retry: config.DBRetry{
+		Attempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond,
+	}}, testLogger{})
+	errReset := fmt.Errorf("read : %w", syscall.ECONNRESET)
+
+	t.Run("retries transient errors", func(t *testing.T) {
+		calls := 0
+		err := s.withRetry(context.Background(), "test", func() error {
+			calls++
+			if calls < 3 {
+				return errReset
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, calls)
+	})
+
+	t.Run("gives up after the attempts", func(t *testing.T) {
+		calls := 0
+		err := s.withRetry(context.Background(), "test", func() error {
+			calls++
+			return errReset
+		})
+		require.ErrorIs(t, err, syscall.ECONNRESET)
+		require.Equal(t, 3, calls)
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		calls := 0
+		err := s.withRetry(context.Background(), "test", func() error {
+			calls++
+			return pgx.PgError{Code: UniqueViolation}
+		})
+		require.Error(t, err)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("runs once in a transaction", func(t *testing.T) {
+		tx := *s
+		tx.inTx = true
+		calls := 0
+		err := tx.withRetry(context.Background(), "test", func() error {
+			calls++
+			return errReset
+		})
+		require.Error(t, err)
+		require.Equal(t, 1, calls)
+	})
+}
@@ -2,209 +2,332 @@ package sqlstorage
 
 import (
 	"context"
-	"errors"
+	"database/sql"
 	"fmt"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/google/uuid"
-	"github.com/jackc/pgconn"
 	"github.com/jmoiron/sqlx"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
 )
 
-var (
-	ErrEventIDAlreadyExist = errors.New("event id already exist")
-	EmptyEvent             = storage.Event{}
-)
+var EmptyEvent = storage.Event{}
+
+type Logger interface {
+	ErrorWithParams(msg string, params map[string]string, err error)
+}
 
 type Storage struct {
-	db        *sqlx.DB
+	db *sqlx.DB
+	// q runs the statements, it is the db or the transaction of WithTx.
+	q         sqlx.ExtContext
+	inTx      bool
 	dsn       string
 	tableName string
+	pool      config.DBPool
+	retry     config.DBRetry
+	lg        Logger
 }
 
-func (s *Storage) Create(ctx context.Context, e storage.Event) error {
+func (s *Storage) Create(ctx context.Context, e storage.Event) (err error) {
+	ctx, span := s.startSpan(ctx, "Create")
+	defer func() { endSpan(span, err) }()
+
 	cols := []string{"id", "title", "date_time", "event_duration", "description", "user_id", "notification_time"}
 	vals := []any{e.ID, e.Title, e.DateTime, e.EventDuration, e.Description, e.UserID, e.NotificationTime}
 	if e.NotificationTime != nil {
 		cols = append(cols, "notification_status")
-		vals = append(vals, "PENDING")
+		vals = append(vals, statusPending)
 	}
 	sql, args, err := sq.Insert(s.tableName).Columns(cols...).Values(vals...).PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return fmt.Errorf("building create user query : %w", err)
 	}
-	_, err = s.db.ExecContext(ctx, sql, args...)
+	_, err = s.q.ExecContext(ctx, sql, args...)
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			if pgErr.Code == UniqueViolation {
-				return ErrEventIDAlreadyExist
-			}
+		if errorCode(err) == UniqueViolation {
+			return storage.ErrEventIDAlreadyExist
 		}
 		return fmt.Errorf("exec create user query : %w", err)
 	}
 	return err
 }
 
-func (s *Storage) Update(ctx context.Context, newEvent storage.Event) error {
-	sql := sq.Update(s.tableName)
-	if newEvent.UserID != nil {
-		sql = sql.Set("user_id", newEvent.UserID)
+func (s *Storage) Update(ctx context.Context, newEvent storage.Event, fields ...storage.Field) (err error) {
+	ctx, span := s.startSpan(ctx, "Update")
+	defer func() { endSpan(span, err) }()
+
+	changes, err := storage.Changes(newEvent, fields...)
+	if err != nil {
+		return err
 	}
-	if newEvent.Title != nil {
-		sql = sql.Set("title", newEvent.Title)
+	if len(changes) == 0 {
+		_, err = s.GetByID(ctx, newEvent.ID)
+		return err
 	}
-	if newEvent.DateTime != nil {
-		sql = sql.Set("date_time", newEvent.DateTime)
+	clauses := make(map[string]any, len(changes))
+	for f, v := range changes {
+		clauses[string(f)] = v
 	}
-	if newEvent.EventDuration != nil {
-		sql = sql.Set("event_duration", newEvent.EventDuration)
+	update := sq.Update(s.tableName).SetMap(clauses).Where(sq.Eq{"id": newEvent.ID})
+	query, args, err := update.PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("error while build update query %w", err)
 	}
-	if newEvent.Description != nil {
-		sql = sql.Set("description", newEvent.Description)
+	var res sql.Result
+	// Setting the same values again is harmless, so the update is retried.
+	err = s.withRetry(ctx, "Update", func() error {
+		res, err = s.q.ExecContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return err
 	}
-	if newEvent.NotificationTime != nil {
-		sql = sql.Set("notification_time", newEvent.NotificationTime)
+	return requireAffected(res)
+}
+
+func (s *Storage) Delete(ctx context.Context, eventID uuid.UUID) (err error) {
+	ctx, span := s.startSpan(ctx, "Delete")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := sq.Delete(s.tableName).Where(sq.Eq{"id": eventID}).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("error while build delete query %w", err)
 	}
-	if newEvent.NotificationStatus != nil {
-		sql = sql.Set("notification_status", newEvent.NotificationStatus)
+	res, err := s.q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
 	}
+	return requireAffected(res)
+}
 
-	sql = sql.Where(sq.Eq{"id": newEvent.ID})
-	query, args, err := sql.PlaceholderFormat(sq.Dollar).ToSql()
+// requireAffected reports a missing event when a statement by id matched no rows.
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("error while build update query %w", err)
+		return err
 	}
-	_, err = s.db.ExecContext(ctx, query, args...)
-	return err
+	if n == 0 {
+		return storage.ErrEventNotFoundErr
+	}
+	return nil
 }
 
-func (s *Storage) Delete(ctx context.Context, eventID uuid.UUID) error {
-	_, err := sq.Delete(s.tableName).
-		Where(sq.Eq{"id": eventID}).
-		PlaceholderFormat(sq.Dollar).
-		RunWith(s.db).
-		ExecContext(ctx)
-	return err
-}
+func (s *Storage) GetEventsByUserID(ctx context.Context, userID uuid.UUID) (_ []storage.Event, err error) {
+	ctx, span := s.startSpan(ctx, "GetEventsByUserID")
+	defer func() { endSpan(span, err) }()
 
-func (s *Storage) GetEventsByUserID(ctx context.Context, userID uuid.UUID) ([]storage.Event, error) {
-	events := make([]storage.Event, 0)
 	sql, args, err := sq.Select("*").From(s.tableName).Where(sq.Eq{"user_id": userID}).
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		return events, err
+		return make([]storage.Event, 0), err
 	}
-	rows, err := s.db.QueryxContext(ctx, sql, args...)
+	events, err := s.selectEvents(ctx, "GetEventsByUserID", sql, args)
 	if err != nil {
 		return events, fmt.Errorf("error while executing select * from events where user_id = $1 : %w", err)
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var event storage.Event
-		err := rows.StructScan(&event)
-		if err != nil {
-			return events, fmt.Errorf(ErrParsingToStructError, "storage.Event", err)
-		}
-		events = append(events, event)
-	}
 	return events, nil
 }
 
-func (s *Storage) GetByID(ctx context.Context, eventID uuid.UUID) (storage.Event, error) {
+func (s *Storage) GetByID(ctx context.Context, eventID uuid.UUID) (_ storage.Event, err error) {
+	ctx, span := s.startSpan(ctx, "GetByID")
+	defer func() { endSpan(span, err) }()
+
 	sql, args, err := sq.Select("*").From(s.tableName).Where(sq.Eq{"id": eventID}).PlaceholderFormat(sq.Dollar).ToSql()
 	if err != nil {
 		return EmptyEvent, err
 	}
-	rows, err := s.db.QueryxContext(ctx, sql, args...)
+	events, err := s.selectEvents(ctx, "GetByID", sql, args)
 	if err != nil {
 		return EmptyEvent, fmt.Errorf("error while executing select * from events where id = $1 : %w", err)
 	}
-	defer rows.Close()
-	if rows.Next() {
-		var event storage.Event
-		err := rows.StructScan(&event)
-		if err != nil {
-			return EmptyEvent, fmt.Errorf(ErrParsingToStructError, "storage.Event", err)
-		}
-		return event, nil
+	if len(events) == 0 {
+		return EmptyEvent, storage.ErrEventNotFoundErr
 	}
-	return EmptyEvent, storage.ErrEventNotFoundErr
+	return events[0], nil
 }
 
-func (s *Storage) FindByCurrentTimeByMinutesAndPendingStatus() ([]storage.Event, error) {
-	events := make([]storage.Event, 0)
+func (s *Storage) FindDueNotifications(ctx context.Context, from, to time.Time) (_ []storage.Event, err error) {
+	ctx, span := s.startSpan(ctx, "FindDueNotifications")
+	defer func() { endSpan(span, err) }()
+
+	// A range on the bare column can use the partial index of pending notifications.
 	sql, args, err := sq.Select("*").From(s.tableName).Where(
 		sq.And{
-			sq.Eq{"notification_status": "PENDING"},
-			sq.Expr("DATE_TRUNC('minute', notification_time) = DATE_TRUNC('minute', NOW())"),
+			sq.Eq{"notification_status": statusPending},
+			sq.GtOrEq{"notification_time": from},
+			sq.Lt{"notification_time": to},
 		}).
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		return events, err
+		return make([]storage.Event, 0), err
 	}
-	rows, err := s.db.Queryx(sql, args...)
+	return s.selectEvents(ctx, "FindDueNotifications", sql, args)
+}
+
+// ExpireNotifications is not retried, a retry after a lost commit would miss the expired ids.
+// The notifications left pending by a failed attempt are expired by the next run.
+func (s *Storage) ExpireNotifications(ctx context.Context, dateTime time.Time) (expired []uuid.UUID, err error) {
+	ctx, span := s.startSpan(ctx, "ExpireNotifications")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := sq.Update(s.tableName).Set("notification_status", statusExpired).
+		Where(sq.And{
+			sq.Eq{"notification_status": statusPending},
+			sq.Lt{"notification_time": dateTime},
+		}).
+		Suffix("RETURNING id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
 	if err != nil {
-		return events, err
+		return nil, fmt.Errorf("error while build expire query %w", err)
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var event storage.Event
-		err := rows.StructScan(&event)
-		if err != nil {
-			return events, fmt.Errorf(ErrParsingToStructError, "storage.Event", err)
-		}
-		events = append(events, event)
+	expired = make([]uuid.UUID, 0)
+	err = sqlx.SelectContext(ctx, s.q, &expired, query, args...)
+	return expired, err
+}
+
+// ReleaseClaims is not retried, a retry after a lost commit would miss the released ids.
+func (s *Storage) ReleaseClaims(ctx context.Context, claimedBefore time.Time) (released []uuid.UUID, err error) {
+	ctx, span := s.startSpan(ctx, "ReleaseClaims")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := sq.Update(s.tableName).
+		Set("notification_status", statusPending).
+		Set("notification_claimed_at", nil).
+		Where(sq.And{
+			sq.Eq{"notification_status": statusPendingSent},
+			sq.Lt{"notification_claimed_at": claimedBefore},
+		}).
+		Suffix("RETURNING id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("error while build release claims query %w", err)
 	}
-	return events, nil
+	released = make([]uuid.UUID, 0)
+	err = sqlx.SelectContext(ctx, s.q, &released, query, args...)
+	return released, err
 }
 
-func (s *Storage) FindByDateTimeMoreOrEqual(dateTime time.Time) ([]storage.Event, error) {
-	events := make([]storage.Event, 0)
-	sql, args, err := sq.Select("*").From(s.tableName).Where(sq.LtOrEq{"date_time": dateTime}).
+func (s *Storage) FindOlderThan(
+	ctx context.Context, dateTime time.Time, limit int,
+) (_ []storage.Event, err error) {
+	ctx, span := s.startSpan(ctx, "FindOlderThan")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := sq.Select("*").From(s.tableName).Where(sq.Lt{"date_time": dateTime}).
+		OrderBy("date_time").
+		Limit(uint64(limit)). //nolint:gosec
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return make([]storage.Event, 0), err
+	}
+	return s.selectEvents(ctx, "FindOlderThan", sql, args)
+}
+
+func (s *Storage) CountOlderThan(ctx context.Context, dateTime time.Time) (count int, err error) {
+	ctx, span := s.startSpan(ctx, "CountOlderThan")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := sq.Select("COUNT(*)").From(s.tableName).Where(sq.Lt{"date_time": dateTime}).
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
-		return events, err
+		return 0, err
+	}
+	err = s.withRetry(ctx, "CountOlderThan", func() error {
+		return sqlx.GetContext(ctx, s.q, &count, query, args...)
+	})
+	return count, err
+}
+
+func (s *Storage) DeleteByIDs(ctx context.Context, eventIDs []uuid.UUID) (_ int, err error) {
+	ctx, span := s.startSpan(ctx, "DeleteByIDs")
+	defer func() { endSpan(span, err) }()
+
+	if len(eventIDs) == 0 {
+		return 0, nil
+	}
+	query, args, err := sq.Delete(s.tableName).Where(sq.Eq{"id": eventIDs}).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("error while build delete query %w", err)
 	}
-	rows, err := s.db.Queryx(sql, args...)
+	var res sql.Result
+	// Deleting the same ids again is harmless, so the delete is retried.
+	err = s.withRetry(ctx, "DeleteByIDs", func() error {
+		res, err = s.q.ExecContext(ctx, query, args...)
+		return err
+	})
 	if err != nil {
-		return events, err
+		return 0, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var event storage.Event
-		err := rows.StructScan(&event)
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// selectEvents runs a read query, reads are retried after transient errors.
+func (s *Storage) selectEvents(ctx context.Context, operation, query string, args []any) ([]storage.Event, error) {
+	events := make([]storage.Event, 0)
+	err := s.withRetry(ctx, operation, func() error {
+		events = events[:0]
+		rows, err := s.q.QueryxContext(ctx, query, args...)
 		if err != nil {
-			return events, fmt.Errorf(ErrParsingToStructError, "storage.Event", err)
+			return err
 		}
-		events = append(events, event)
-	}
-	return events, nil
+		defer rows.Close()
+		for rows.Next() {
+			var event storage.Event
+			if err := rows.StructScan(&event); err != nil {
+				return fmt.Errorf(ErrParsingToStructError, "storage.Event", err)
+			}
+			events = append(events, event)
+		}
+		return rows.Err()
+	})
+	return events, err
 }
 
-func New(dsn string, cfg config.DBConf) *Storage {
+func New(dsn string, cfg config.DBConf, lg Logger) *Storage {
 	tables := cfg.Tables
 	return &Storage{
 		dsn:       dsn,
 		tableName: tables.Schema + "." + "events",
+		pool:      cfg.Pool,
+		retry:     cfg.Retry,
+		lg:        lg,
 	}
 }
 
+// Connect opens the connection pool and waits up to the startup timeout for the database,
+// so the binaries may start before postgres accepts connections.
 func (s *Storage) Connect(ctx context.Context) error {
-	db, err := sqlx.ConnectContext(ctx, "pgx", s.dsn)
+	db, err := sqlx.Open("pgx", s.dsn)
 	if err != nil {
 		return fmt.Errorf("failed to connect to db : %w", err)
 	}
+	db.SetMaxOpenConns(s.pool.MaxOpenConns)
+	db.SetMaxIdleConns(s.pool.MaxIdleConns)
+	db.SetConnMaxLifetime(s.pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(s.pool.ConnMaxIdleTime)
+	if err := s.waitForDB(ctx, db); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("failed to connect to db : %w", err)
+	}
 	s.db = db
+	s.q = db
 	return nil
 }
 
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 func (s *Storage) Close() error {
 	err := s.db.Close()
 	if err != nil {
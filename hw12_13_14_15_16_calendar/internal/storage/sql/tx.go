@@ -0,0 +1,80 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+)
+
+const (
+	maxTxAttempts = 5
+	txRetryDelay  = 10 * time.Millisecond
+)
+
+// WithTx runs fn in a serializable transaction. Transactions that fail
+// with a serialization failure or deadlock are retried with a growing delay.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx storage.Repository) error) (err error) {
+	ctx, span := s.startSpan(ctx, "WithTx")
+	defer func() { endSpan(span, err) }()
+
+	for attempt := 1; ; attempt++ {
+		err = s.runTx(ctx, fn)
+		if !retryable(err) || attempt == maxTxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(time.Duration(attempt) * txRetryDelay):
+		}
+	}
+}
+
+func (s *Storage) runTx(ctx context.Context, fn func(tx storage.Repository) error) (err error) {
+	tx, err := s.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction : %w", err)
+	}
+	// The rollback is deferred to release the connection when fn panics or calls runtime.Goexit,
+	// after a commit it does nothing.
+	defer func() {
+		err = errors.Join(err, ignoreDone(tx.Rollback()))
+	}()
+	txStorage := *s
+	txStorage.q, txStorage.inTx = tx, true
+	if err := fn(&txStorage); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func ignoreDone(err error) error {
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
+
+func retryable(err error) bool {
+	code := errorCode(err)
+	return code == SerializationFailure || code == DeadlockDetected
+}
+
+// errorCode returns the SQLSTATE of a postgres error, the pgx v3 driver returns PgError values.
+func errorCode(err error) string {
+	var pgErr pgx.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	var pgconnErr *pgconn.PgError
+	if errors.As(err, &pgconnErr) {
+		return pgconnErr.Code
+	}
+	return ""
+}
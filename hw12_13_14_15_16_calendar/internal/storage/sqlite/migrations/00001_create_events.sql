@@ -0,0 +1,17 @@
+-- +goose Up
+-- Times are unix microseconds and durations nanoseconds, so they compare as numbers.
+CREATE TABLE events (
+    id                  TEXT PRIMARY KEY,
+    title               TEXT    NOT NULL,
+    date_time           INTEGER NOT NULL,
+    event_duration      INTEGER NOT NULL,
+    description         TEXT,
+    user_id             TEXT    NOT NULL,
+    notification_time   INTEGER,
+    notification_status TEXT CHECK (notification_status IN ('PENDING', 'SENT', 'PENDING_SENT'))
+);
+
+CREATE INDEX events_user_id_idx ON events (user_id);
+
+-- +goose Down
+DROP TABLE events;
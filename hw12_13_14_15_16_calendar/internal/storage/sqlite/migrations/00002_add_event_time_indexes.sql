@@ -0,0 +1,12 @@
+-- +goose Up
+DROP INDEX events_user_id_idx;
+CREATE INDEX events_user_id_date_time_idx ON events (user_id, date_time);
+CREATE INDEX events_pending_notification_time_idx ON events (notification_time)
+    WHERE notification_status = 'PENDING';
+CREATE INDEX events_date_time_idx ON events (date_time);
+
+-- +goose Down
+DROP INDEX events_date_time_idx;
+DROP INDEX events_pending_notification_time_idx;
+DROP INDEX events_user_id_date_time_idx;
+CREATE INDEX events_user_id_idx ON events (user_id);
@@ -0,0 +1,42 @@
+-- +goose Up
+-- SQLite cannot change a CHECK constraint, the table is rebuilt with the new status.
+CREATE TABLE events_new (
+    id                  TEXT PRIMARY KEY,
+    title               TEXT    NOT NULL,
+    date_time           INTEGER NOT NULL,
+    event_duration      INTEGER NOT NULL,
+    description         TEXT,
+    user_id             TEXT    NOT NULL,
+    notification_time   INTEGER,
+    notification_status TEXT CHECK (notification_status IN ('PENDING', 'SENT', 'PENDING_SENT', 'EXPIRED'))
+);
+INSERT INTO events_new SELECT * FROM events;
+DROP TABLE events;
+ALTER TABLE events_new RENAME TO events;
+
+CREATE INDEX events_user_id_date_time_idx ON events (user_id, date_time);
+CREATE INDEX events_pending_notification_time_idx ON events (notification_time)
+    WHERE notification_status = 'PENDING';
+CREATE INDEX events_date_time_idx ON events (date_time);
+
+-- +goose Down
+-- Expired notifications were never published, so they become PENDING.
+UPDATE events SET notification_status = 'PENDING' WHERE notification_status = 'EXPIRED';
+CREATE TABLE events_old (
+    id                  TEXT PRIMARY KEY,
+    title               TEXT    NOT NULL,
+    date_time           INTEGER NOT NULL,
+    event_duration      INTEGER NOT NULL,
+    description         TEXT,
+    user_id             TEXT    NOT NULL,
+    notification_time   INTEGER,
+    notification_status TEXT CHECK (notification_status IN ('PENDING', 'SENT', 'PENDING_SENT'))
+);
+INSERT INTO events_old SELECT * FROM events;
+DROP TABLE events;
+ALTER TABLE events_old RENAME TO events;
+
+CREATE INDEX events_user_id_date_time_idx ON events (user_id, date_time);
+CREATE INDEX events_pending_notification_time_idx ON events (notification_time)
+    WHERE notification_status = 'PENDING';
+CREATE INDEX events_date_time_idx ON events (date_time);
@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE events ADD COLUMN notification_claimed_at INTEGER;
+CREATE INDEX events_notification_claimed_at_idx ON events (notification_claimed_at)
+    WHERE notification_claimed_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX events_notification_claimed_at_idx;
+ALTER TABLE events DROP COLUMN notification_claimed_at;
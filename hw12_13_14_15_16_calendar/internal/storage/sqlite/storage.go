@@ -0,0 +1,372 @@
+package sqlitestorage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/database"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	tableName         = "events"
+	statusPending     = "PENDING"
+	statusPendingSent = "PENDING_SENT"
+	statusExpired     = "EXPIRED"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Storage keeps events in a single sqlite file, it needs no database server.
+type Storage struct {
+	db *sqlx.DB
+	// q runs the statements, it is the db or the transaction of WithTx.
+	q    sqlx.ExtContext
+	path string
+}
+
+// row is an event as stored by sqlite, which has no time types.
+type row struct {
+	ID                 uuid.UUID      `db:"id"`
+	Title              string         `db:"title"`
+	DateTime           int64          `db:"date_time"`
+	EventDuration      int64          `db:"event_duration"`
+	Description        sql.NullString `db:"description"`
+	UserID             uuid.UUID      `db:"user_id"`
+	NotificationTime   sql.NullInt64  `db:"notification_time"`
+	NotificationStatus sql.NullString `db:"notification_status"`
+	ClaimedAt          sql.NullInt64  `db:"notification_claimed_at"`
+}
+
+func (r row) event() storage.Event {
+	dateTime := time.UnixMicro(r.DateTime)
+	duration := time.Duration(r.EventDuration)
+	e := storage.Event{
+		ID:            r.ID,
+		Title:         &r.Title,
+		DateTime:      &dateTime,
+		EventDuration: &duration,
+		UserID:        &r.UserID,
+	}
+	if r.Description.Valid {
+		e.Description = &r.Description.String
+	}
+	if r.NotificationTime.Valid {
+		t := time.UnixMicro(r.NotificationTime.Int64)
+		e.NotificationTime = &t
+	}
+	if r.NotificationStatus.Valid {
+		e.NotificationStatus = &r.NotificationStatus.String
+	}
+	if r.ClaimedAt.Valid {
+		t := time.UnixMicro(r.ClaimedAt.Int64)
+		e.NotificationClaimedAt = &t
+	}
+	return e
+}
+
+// value converts an event field to its column value.
+func value(v any) any {
+	switch p := v.(type) {
+	case *time.Time:
+		if p == nil {
+			return nil
+		}
+		return p.UnixMicro()
+	case *time.Duration:
+		if p == nil {
+			return nil
+		}
+		return int64(*p)
+	case *uuid.UUID:
+		if p == nil {
+			return nil
+		}
+		return p.String()
+	case *string:
+		if p == nil {
+			return nil
+		}
+		return *p
+	default:
+		return v
+	}
+}
+
+func New(path string) *Storage {
+	return &Storage{path: path}
+}
+
+// Connect opens the database file, creating it if needed, and applies the migrations.
+func (s *Storage) Connect(ctx context.Context) error {
+	dsn := "file:" + s.path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sqlx.ConnectContext(ctx, "sqlite", dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open sqlite database %s : %w", s.path, err)
+	}
+	// sqlite serializes writers, a single connection avoids busy errors under concurrent requests.
+	db.SetMaxOpenConns(1)
+	if err := migrate(ctx, db.DB); err != nil {
+		_ = db.Close()
+		return err
+	}
+	s.db = db
+	s.q = db
+	return nil
+}
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+	provider, err := goose.NewProvider(database.DialectSQLite3, db, fsys, goose.WithDisableGlobalRegistry(true))
+	if err != nil {
+		return fmt.Errorf("failed to load sqlite migrations : %w", err)
+	}
+	if _, err := provider.Up(ctx); err != nil {
+		return fmt.Errorf("failed to migrate sqlite database : %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+func (s *Storage) Create(ctx context.Context, e storage.Event) (err error) {
+	ctx, span := startSpan(ctx, "Create")
+	defer func() { endSpan(span, err) }()
+
+	var status any
+	if e.NotificationTime != nil {
+		status = statusPending
+	}
+	query, args, err := sq.Insert(tableName).
+		Columns("id", "title", "date_time", "event_duration", "description", "user_id",
+			"notification_time", "notification_status").
+		Values(e.ID.String(), value(e.Title), value(e.DateTime), value(e.EventDuration), value(e.Description),
+			value(e.UserID), value(e.NotificationTime), status).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("building create event query : %w", err)
+	}
+	if _, err = s.q.ExecContext(ctx, query, args...); err != nil {
+		var sqliteErr *sqlite.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY {
+			return storage.ErrEventIDAlreadyExist
+		}
+		return fmt.Errorf("exec create event query : %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) Update(ctx context.Context, newEvent storage.Event, fields ...storage.Field) (err error) {
+	ctx, span := startSpan(ctx, "Update")
+	defer func() { endSpan(span, err) }()
+
+	changes, err := storage.Changes(newEvent, fields...)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		_, err = s.GetByID(ctx, newEvent.ID)
+		return err
+	}
+	clauses := make(map[string]any, len(changes))
+	for f, v := range changes {
+		clauses[string(f)] = value(v)
+	}
+	query, args, err := sq.Update(tableName).SetMap(clauses).Where(sq.Eq{"id": newEvent.ID.String()}).ToSql()
+	if err != nil {
+		return fmt.Errorf("building update event query : %w", err)
+	}
+	res, err := s.q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (s *Storage) Delete(ctx context.Context, eventID uuid.UUID) (err error) {
+	ctx, span := startSpan(ctx, "Delete")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := sq.Delete(tableName).Where(sq.Eq{"id": eventID.String()}).ToSql()
+	if err != nil {
+		return fmt.Errorf("building delete event query : %w", err)
+	}
+	res, err := s.q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// requireAffected reports a missing event when a statement by id matched no rows.
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrEventNotFoundErr
+	}
+	return nil
+}
+
+func (s *Storage) GetEventsByUserID(ctx context.Context, userID uuid.UUID) (_ []storage.Event, err error) {
+	ctx, span := startSpan(ctx, "GetEventsByUserID")
+	defer func() { endSpan(span, err) }()
+
+	return s.selectEvents(ctx, sq.Eq{"user_id": userID.String()})
+}
+
+func (s *Storage) GetByID(ctx context.Context, eventID uuid.UUID) (_ storage.Event, err error) {
+	ctx, span := startSpan(ctx, "GetByID")
+	defer func() { endSpan(span, err) }()
+
+	events, err := s.selectEvents(ctx, sq.Eq{"id": eventID.String()})
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if len(events) == 0 {
+		return storage.Event{}, storage.ErrEventNotFoundErr
+	}
+	return events[0], nil
+}
+
+func (s *Storage) FindDueNotifications(ctx context.Context, from, to time.Time) (_ []storage.Event, err error) {
+	ctx, span := startSpan(ctx, "FindDueNotifications")
+	defer func() { endSpan(span, err) }()
+
+	return s.selectEvents(ctx, sq.And{
+		sq.Eq{"notification_status": statusPending},
+		sq.GtOrEq{"notification_time": from.UnixMicro()},
+		sq.Lt{"notification_time": to.UnixMicro()},
+	})
+}
+
+func (s *Storage) ExpireNotifications(ctx context.Context, dateTime time.Time) (_ []uuid.UUID, err error) {
+	ctx, span := startSpan(ctx, "ExpireNotifications")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := sq.Update(tableName).Set("notification_status", statusExpired).
+		Where(sq.And{
+			sq.Eq{"notification_status": statusPending},
+			sq.Lt{"notification_time": dateTime.UnixMicro()},
+		}).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("building expire notifications query : %w", err)
+	}
+	expired := make([]uuid.UUID, 0)
+	if err := sqlx.SelectContext(ctx, s.q, &expired, query, args...); err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
+
+func (s *Storage) ReleaseClaims(ctx context.Context, claimedBefore time.Time) (_ []uuid.UUID, err error) {
+	ctx, span := startSpan(ctx, "ReleaseClaims")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := sq.Update(tableName).
+		Set("notification_status", statusPending).
+		Set("notification_claimed_at", nil).
+		Where(sq.And{
+			sq.Eq{"notification_status": statusPendingSent},
+			sq.Lt{"notification_claimed_at": claimedBefore.UnixMicro()},
+		}).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("building release claims query : %w", err)
+	}
+	released := make([]uuid.UUID, 0)
+	if err := sqlx.SelectContext(ctx, s.q, &released, query, args...); err != nil {
+		return nil, err
+	}
+	return released, nil
+}
+
+func (s *Storage) FindOlderThan(ctx context.Context, dateTime time.Time, limit int) (_ []storage.Event, err error) {
+	ctx, span := startSpan(ctx, "FindOlderThan")
+	defer func() { endSpan(span, err) }()
+
+	return s.query(ctx, sq.Select("*").From(tableName).Where(sq.Lt{"date_time": dateTime.UnixMicro()}).
+		OrderBy("date_time").
+		Limit(uint64(limit))) //nolint:gosec
+}
+
+func (s *Storage) CountOlderThan(ctx context.Context, dateTime time.Time) (count int, err error) {
+	ctx, span := startSpan(ctx, "CountOlderThan")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := sq.Select("COUNT(*)").From(tableName).Where(sq.Lt{"date_time": dateTime.UnixMicro()}).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	err = sqlx.GetContext(ctx, s.q, &count, query, args...)
+	return count, err
+}
+
+func (s *Storage) DeleteByIDs(ctx context.Context, eventIDs []uuid.UUID) (_ int, err error) {
+	ctx, span := startSpan(ctx, "DeleteByIDs")
+	defer func() { endSpan(span, err) }()
+
+	if len(eventIDs) == 0 {
+		return 0, nil
+	}
+	ids := make([]string, 0, len(eventIDs))
+	for _, id := range eventIDs {
+		ids = append(ids, id.String())
+	}
+	query, args, err := sq.Delete(tableName).Where(sq.Eq{"id": ids}).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("building delete events query : %w", err)
+	}
+	res, err := s.q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *Storage) selectEvents(ctx context.Context, where sq.Sqlizer) ([]storage.Event, error) {
+	return s.query(ctx, sq.Select("*").From(tableName).Where(where))
+}
+
+func (s *Storage) query(ctx context.Context, b sq.SelectBuilder) ([]storage.Event, error) {
+	query, args, err := b.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var rows []row
+	if err := sqlx.SelectContext(ctx, s.q, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("error while executing %s : %w", query, err)
+	}
+	events := make([]storage.Event, 0, len(rows))
+	for _, r := range rows {
+		events = append(events, r.event())
+	}
+	return events, nil
+}
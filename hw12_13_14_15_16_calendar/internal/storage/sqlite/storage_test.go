@@ -0,0 +1,99 @@
+package sqlitestorage
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s := New(filepath.Join(t.TempDir(), "calendar.db"))
+		require.NoError(t, s.Connect(context.Background()))
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	})
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "calendar.db")
+	event := storagetest.NewEvent()
+
+	s := New(path)
+	require.NoError(t, s.Connect(ctx))
+	require.NoError(t, s.Create(ctx, event))
+	require.NoError(t, s.Close())
+
+	// Migrations are applied once, the data survives a restart.
+	s = New(path)
+	require.NoError(t, s.Connect(ctx))
+	defer s.Close()
+	got, err := s.GetByID(ctx, event.ID)
+	require.NoError(t, err)
+	require.Equal(t, *event.Title, *got.Title)
+}
+
+// recorder keeps the last query run by the storage, so its plan can be checked.
+type recorder struct {
+	sqlx.ExtContext
+	query string
+	args  []any
+}
+
+func (r *recorder) QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error) {
+	r.query, r.args = query, args
+	return r.ExtContext.QueryxContext(ctx, query, args...)
+}
+
+func TestQueryPlans(t *testing.T) {
+	ctx := context.Background()
+	s := New(filepath.Join(t.TempDir(), "calendar.db"))
+	require.NoError(t, s.Connect(ctx))
+	defer s.Close()
+	rec := &recorder{ExtContext: s.q}
+	s.q = rec
+
+	tests := []struct {
+		index string
+		run   func() error
+	}{
+		{"events_pending_notification_time_idx", func() error {
+			_, err := s.FindDueNotifications(ctx, time.Now().Add(-15*time.Minute), time.Now())
+			return err
+		}},
+		{"events_user_id_date_time_idx", func() error {
+			_, err := s.GetEventsByUserID(ctx, uuid.New())
+			return err
+		}},
+		{"events_date_time_idx", func() error {
+			_, err := s.FindOlderThan(ctx, time.Now(), 500)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.index, func(t *testing.T) {
+			require.NoError(t, tt.run())
+			var plan []struct {
+				ID      int    `db:"id"`
+				Parent  int    `db:"parent"`
+				NotUsed int    `db:"notused"`
+				Detail  string `db:"detail"`
+			}
+			require.NoError(t, sqlx.SelectContext(ctx, s.db, &plan, "EXPLAIN QUERY PLAN "+rec.query, rec.args...))
+			details := make([]string, 0, len(plan))
+			for _, p := range plan {
+				details = append(details, p.Detail)
+			}
+			require.Contains(t, strings.Join(details, "\n"), tt.index)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package sqlitestorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+)
+
+// WithTx runs fn in a transaction. sqlite serializes writers, so there are no conflicts to retry.
+func (s *Storage) WithTx(ctx context.Context, fn func(tx storage.Repository) error) (err error) {
+	ctx, span := startSpan(ctx, "WithTx")
+	defer func() { endSpan(span, err) }()
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction : %w", err)
+	}
+	// The rollback is deferred to release the only connection when fn panics or calls runtime.Goexit,
+	// after a commit it does nothing.
+	defer func() {
+		rbErr := tx.Rollback()
+		if errors.Is(rbErr, sql.ErrTxDone) {
+			rbErr = nil
+		}
+		err = errors.Join(err, rbErr)
+	}()
+	if err := fn(&Storage{db: s.db, q: tx, path: s.path}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Repository holds the event operations, they are provided by a storage and by its transactions.
+type Repository interface {
+	Create(ctx context.Context, event Event) error
+	GetEventsByUserID(ctx context.Context, userID uuid.UUID) ([]Event, error)
+	GetByID(ctx context.Context, eventID uuid.UUID) (Event, error)
+	Update(ctx context.Context, event Event, fields ...Field) error
+	Delete(ctx context.Context, eventID uuid.UUID) error
+	// FindDueNotifications returns pending events with a notification time from from inclusive to to exclusive,
+	// the window starts where ExpireNotifications stops.
+	FindDueNotifications(ctx context.Context, from, to time.Time) ([]Event, error)
+	// ExpireNotifications marks pending notifications due before dateTime as expired, it returns the ids of the events.
+	ExpireNotifications(ctx context.Context, dateTime time.Time) ([]uuid.UUID, error)
+	// ReleaseClaims returns notifications claimed before claimedBefore and never published to pending,
+	// it returns the ids of the events.
+	ReleaseClaims(ctx context.Context, claimedBefore time.Time) ([]uuid.UUID, error)
+	// FindOlderThan returns at most limit events that take place before dateTime, the oldest first.
+	FindOlderThan(ctx context.Context, dateTime time.Time, limit int) ([]Event, error)
+	CountOlderThan(ctx context.Context, dateTime time.Time) (int, error)
+	// DeleteByIDs deletes the events with the ids, missing ones are skipped. It returns the number of deleted events.
+	DeleteByIDs(ctx context.Context, eventIDs []uuid.UUID) (int, error)
+}
+
+// Storage is implemented by every backend, it covers what the service, scheduler and sender need.
+type Storage interface {
+	Repository
+	// WithTx runs fn as a unit of work: either all of its changes are stored or, when fn
+	// or the commit fails, none. Reads inside fn see its own changes and are isolated from
+	// concurrent units of work. fn may be run again when the backend retries a conflict,
+	// so it must not have effects outside of tx.
+	WithTx(ctx context.Context, fn func(tx Repository) error) error
+}
@@ -0,0 +1,608 @@
+// Package storagetest is a conformance suite for event storage backends.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Run checks that the backend returned by newStorage behaves like every other backend.
+// The storage may be shared between tests, every test works with its own users and events.
+func Run(t *testing.T, newStorage func(t *testing.T) storage.Storage) {
+	t.Helper()
+	tests := []struct {
+		name string
+		test func(t *testing.T, s storage.Storage)
+	}{
+		{"create and get", testCreateAndGet},
+		{"create duplicate id", testCreateDuplicate},
+		{"get events by user id", testGetByUserID},
+		{"get unknown event", testGetUnknown},
+		{"update all fields", testUpdateAll},
+		{"update by mask", testUpdateMask},
+		{"update notification", testUpdateNotification},
+		{"update unknown event", testUpdateUnknown},
+		{"delete", testDelete},
+		{"delete unknown event", testDeleteUnknown},
+		{"find due notifications", testFindDue},
+		{"expire notifications", testExpire},
+		{"release claims", testReleaseClaims},
+		{"find old events", testFindOld},
+		{"delete by ids", testDeleteByIDs},
+		{"concurrent access", testConcurrent},
+		{"transaction commit", testTxCommit},
+		{"transaction rollback", testTxRollback},
+		{"transaction rollback on panic", testTxPanic},
+		{"transaction reads its own changes", testTxReadOwnChanges},
+		{"concurrent transactions", testTxConcurrent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+// NewEvent returns a valid event of a new user with a notification an hour before the event.
+func NewEvent() storage.Event {
+	userID := uuid.New()
+	title := "title"
+	description := "description"
+	// Postgres keeps microseconds, the suite compares values after a round trip.
+	dateTime := time.Now().Add(24 * time.Hour).Truncate(time.Microsecond)
+	notificationTime := dateTime.Add(-time.Hour)
+	duration := time.Hour
+	return storage.Event{
+		ID:               uuid.New(),
+		Title:            &title,
+		DateTime:         &dateTime,
+		EventDuration:    &duration,
+		Description:      &description,
+		UserID:           &userID,
+		NotificationTime: &notificationTime,
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// RequireEqual fails unless the events hold the same values, times are compared as instants.
+func RequireEqual(t *testing.T, want, got storage.Event) {
+	t.Helper()
+	require.Equal(t, want.ID, got.ID)
+	require.Equal(t, want.Title, got.Title)
+	require.Equal(t, want.Description, got.Description)
+	require.Equal(t, want.UserID, got.UserID)
+	require.Equal(t, want.EventDuration, got.EventDuration)
+	require.Equal(t, want.NotificationStatus, got.NotificationStatus)
+	requireSameTime(t, want.DateTime, got.DateTime)
+	requireSameTime(t, want.NotificationTime, got.NotificationTime)
+}
+
+func requireSameTime(t *testing.T, want, got *time.Time) {
+	t.Helper()
+	if want == nil || got == nil {
+		require.Equal(t, want, got)
+		return
+	}
+	require.True(t, want.Equal(*got), "want %s, got %s", want, got)
+}
+
+func ids(events []storage.Event) []uuid.UUID {
+	result := make([]uuid.UUID, 0, len(events))
+	for _, e := range events {
+		result = append(result, e.ID)
+	}
+	return result
+}
+
+func mustCreate(t *testing.T, s storage.Storage, event storage.Event) {
+	t.Helper()
+	require.NoError(t, s.Create(context.Background(), event))
+}
+
+func mustGet(t *testing.T, s storage.Storage, id uuid.UUID) storage.Event {
+	t.Helper()
+	event, err := s.GetByID(context.Background(), id)
+	require.NoError(t, err)
+	return event
+}
+
+func testCreateAndGet(t *testing.T, s storage.Storage) {
+	withNotification := NewEvent()
+	mustCreate(t, s, withNotification)
+	withNotification.NotificationStatus = ptr("PENDING")
+	RequireEqual(t, withNotification, mustGet(t, s, withNotification.ID))
+
+	withoutNotification := NewEvent()
+	withoutNotification.NotificationTime = nil
+	withoutNotification.Description = nil
+	mustCreate(t, s, withoutNotification)
+	RequireEqual(t, withoutNotification, mustGet(t, s, withoutNotification.ID))
+}
+
+func testCreateDuplicate(t *testing.T, s storage.Storage) {
+	event := NewEvent()
+	mustCreate(t, s, event)
+
+	duplicate := NewEvent()
+	duplicate.ID = event.ID
+	require.ErrorIs(t, s.Create(context.Background(), duplicate), storage.ErrEventIDAlreadyExist)
+	require.Equal(t, event.UserID, mustGet(t, s, event.ID).UserID)
+}
+
+func testGetByUserID(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	first, second, other := NewEvent(), NewEvent(), NewEvent()
+	second.UserID = first.UserID
+	mustCreate(t, s, first)
+	mustCreate(t, s, second)
+	mustCreate(t, s, other)
+
+	events, err := s.GetEventsByUserID(ctx, *first.UserID)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []uuid.UUID{first.ID, second.ID}, ids(events))
+
+	events, err = s.GetEventsByUserID(ctx, uuid.New())
+	require.NoError(t, err)
+	require.NotNil(t, events)
+	require.Empty(t, events)
+}
+
+func testGetUnknown(t *testing.T, s storage.Storage) {
+	_, err := s.GetByID(context.Background(), uuid.New())
+	require.ErrorIs(t, err, storage.ErrEventNotFoundErr)
+}
+
+func testUpdateAll(t *testing.T, s storage.Storage) {
+	event := NewEvent()
+	mustCreate(t, s, event)
+
+	update := NewEvent()
+	update.ID = event.ID
+	update.Title = ptr("new title")
+	update.Description = ptr("new description")
+	require.NoError(t, s.Update(context.Background(), update))
+
+	update.NotificationStatus = ptr("PENDING")
+	RequireEqual(t, update, mustGet(t, s, event.ID))
+
+	events, err := s.GetEventsByUserID(context.Background(), *update.UserID)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	RequireEqual(t, update, events[0])
+
+	events, err = s.GetEventsByUserID(context.Background(), *event.UserID)
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func testUpdateMask(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	event := NewEvent()
+	mustCreate(t, s, event)
+
+	require.NoError(t, s.Update(ctx, storage.Event{ID: event.ID, Title: ptr("only title")}))
+	got := mustGet(t, s, event.ID)
+	require.Equal(t, "only title", *got.Title)
+	require.Equal(t, event.Description, got.Description)
+
+	err := s.Update(ctx, storage.Event{ID: event.ID, Title: ptr("from mask")},
+		storage.FieldTitle, storage.FieldDescription)
+	require.NoError(t, err)
+	got = mustGet(t, s, event.ID)
+	require.Equal(t, "from mask", *got.Title)
+	require.Nil(t, got.Description)
+
+	err = s.Update(ctx, storage.Event{ID: event.ID}, storage.FieldTitle)
+	require.ErrorIs(t, err, storage.ErrFieldNotNullable)
+	require.Equal(t, "from mask", *mustGet(t, s, event.ID).Title)
+}
+
+func testUpdateNotification(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	event := NewEvent()
+	mustCreate(t, s, event)
+
+	require.NoError(t, s.Update(ctx, storage.Event{ID: event.ID, NotificationStatus: ptr("SENT")}))
+	require.Equal(t, "SENT", *mustGet(t, s, event.ID).NotificationStatus)
+
+	// A new notification time has to be sent again.
+	later := event.NotificationTime.Add(time.Minute)
+	require.NoError(t, s.Update(ctx, storage.Event{ID: event.ID, NotificationTime: &later}))
+	got := mustGet(t, s, event.ID)
+	requireSameTime(t, &later, got.NotificationTime)
+	require.Equal(t, "PENDING", *got.NotificationStatus)
+
+	require.NoError(t, s.Update(ctx, storage.Event{ID: event.ID}, storage.FieldNotificationTime))
+	got = mustGet(t, s, event.ID)
+	require.Nil(t, got.NotificationTime)
+	require.Nil(t, got.NotificationStatus)
+}
+
+func testUpdateUnknown(t *testing.T, s storage.Storage) {
+	err := s.Update(context.Background(), storage.Event{ID: uuid.New(), Title: ptr("title")})
+	require.ErrorIs(t, err, storage.ErrEventNotFoundErr)
+	err = s.Update(context.Background(), storage.Event{ID: uuid.New()})
+	require.ErrorIs(t, err, storage.ErrEventNotFoundErr)
+}
+
+func testDelete(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	deleted, kept := NewEvent(), NewEvent()
+	kept.UserID = deleted.UserID
+	mustCreate(t, s, deleted)
+	mustCreate(t, s, kept)
+
+	require.NoError(t, s.Delete(ctx, deleted.ID))
+	_, err := s.GetByID(ctx, deleted.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFoundErr)
+
+	events, err := s.GetEventsByUserID(ctx, *kept.UserID)
+	require.NoError(t, err)
+	require.Equal(t, []uuid.UUID{kept.ID}, ids(events))
+}
+
+func testDeleteUnknown(t *testing.T, s storage.Storage) {
+	require.ErrorIs(t, s.Delete(context.Background(), uuid.New()), storage.ErrEventNotFoundErr)
+}
+
+func testFindDue(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Microsecond)
+	from := now.Add(-time.Hour)
+
+	due := NewEvent()
+	due.NotificationTime = ptr(now.Add(-time.Microsecond))
+	mustCreate(t, s, due)
+
+	atEnd := NewEvent()
+	atEnd.NotificationTime = &now
+	mustCreate(t, s, atEnd)
+
+	late := NewEvent()
+	late.NotificationTime = &from
+	mustCreate(t, s, late)
+
+	tooLate := NewEvent()
+	tooLate.NotificationTime = ptr(from.Add(-time.Microsecond))
+	mustCreate(t, s, tooLate)
+
+	sent := NewEvent()
+	sent.NotificationTime = &now
+	mustCreate(t, s, sent)
+	require.NoError(t, s.Update(ctx, storage.Event{ID: sent.ID, NotificationStatus: ptr("SENT")}))
+
+	notYet := NewEvent()
+	mustCreate(t, s, notYet)
+
+	withoutNotification := NewEvent()
+	withoutNotification.NotificationTime = nil
+	mustCreate(t, s, withoutNotification)
+
+	events, err := s.FindDueNotifications(ctx, from, now)
+	require.NoError(t, err)
+	found := ids(events)
+	require.Contains(t, found, due.ID)
+	require.Contains(t, found, late.ID)
+	require.NotContains(t, found, tooLate.ID)
+	require.NotContains(t, found, atEnd.ID, "the window is half-open, the next run picks the end up")
+	require.NotContains(t, found, sent.ID)
+	require.NotContains(t, found, notYet.ID)
+	require.NotContains(t, found, withoutNotification.ID)
+}
+
+func testExpire(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	// Far in the past, so other tests sharing the storage do not expire each other's notifications.
+	boundary := time.Now().AddDate(-10, 0, 0).Truncate(time.Microsecond)
+
+	missed := NewEvent()
+	missed.NotificationTime = ptr(boundary.Add(-time.Minute))
+	mustCreate(t, s, missed)
+
+	sent := NewEvent()
+	sent.NotificationTime = ptr(boundary.Add(-time.Minute))
+	mustCreate(t, s, sent)
+	require.NoError(t, s.Update(ctx, storage.Event{ID: sent.ID, NotificationStatus: ptr("SENT")}))
+
+	inWindow := NewEvent()
+	inWindow.NotificationTime = &boundary
+	mustCreate(t, s, inWindow)
+
+	expired, err := s.ExpireNotifications(ctx, boundary)
+	require.NoError(t, err)
+	require.Contains(t, expired, missed.ID)
+	require.NotContains(t, expired, sent.ID)
+	require.NotContains(t, expired, inWindow.ID)
+	require.Equal(t, "EXPIRED", *mustGet(t, s, missed.ID).NotificationStatus)
+	require.Equal(t, "SENT", *mustGet(t, s, sent.ID).NotificationStatus)
+	require.Equal(t, "PENDING", *mustGet(t, s, inWindow.ID).NotificationStatus)
+
+	events, err := s.FindDueNotifications(ctx, boundary.Add(-time.Hour), boundary)
+	require.NoError(t, err)
+	require.NotContains(t, ids(events), missed.ID, "expired notifications are not due")
+
+	expired, err = s.ExpireNotifications(ctx, boundary)
+	require.NoError(t, err)
+	require.NotContains(t, expired, missed.ID)
+}
+
+func testReleaseClaims(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	// Far in the past, so other tests sharing the storage do not release each other's claims.
+	boundary := time.Now().AddDate(-10, 0, 0).Truncate(time.Microsecond)
+	claim := func(claimedAt time.Time) storage.Event {
+		e := NewEvent()
+		mustCreate(t, s, e)
+		require.NoError(t, s.Update(ctx, storage.Event{
+			ID:                    e.ID,
+			NotificationStatus:    ptr("PENDING_SENT"),
+			NotificationClaimedAt: &claimedAt,
+		}))
+		return e
+	}
+	stale := claim(boundary.Add(-time.Minute))
+	fresh := claim(boundary)
+	published := claim(boundary.Add(-time.Minute))
+	require.NoError(t, s.Update(ctx, storage.Event{ID: published.ID},
+		storage.FieldNotificationClaimedAt))
+	require.Equal(t, "PENDING_SENT", *mustGet(t, s, published.ID).NotificationStatus)
+	require.Equal(t, boundary, *mustGet(t, s, fresh.ID).NotificationClaimedAt)
+
+	released, err := s.ReleaseClaims(ctx, boundary)
+	require.NoError(t, err)
+	require.Contains(t, released, stale.ID)
+	require.NotContains(t, released, fresh.ID)
+	require.NotContains(t, released, published.ID, "a published notification is not claimed")
+	got := mustGet(t, s, stale.ID)
+	require.Equal(t, "PENDING", *got.NotificationStatus)
+	require.Nil(t, got.NotificationClaimedAt)
+
+	require.NoError(t, s.Update(ctx, storage.Event{ID: fresh.ID, NotificationStatus: ptr("SENT")}))
+	require.Nil(t, mustGet(t, s, fresh.ID).NotificationClaimedAt, "a new status clears the claim")
+}
+
+// newOldEvents creates events an hour, two hours and so on before boundary, the oldest last.
+func newOldEvents(t *testing.T, s storage.Storage, boundary time.Time, n int) []storage.Event {
+	t.Helper()
+	events := make([]storage.Event, 0, n)
+	for i := 1; i <= n; i++ {
+		event := NewEvent()
+		event.DateTime = ptr(boundary.Add(-time.Duration(i) * time.Hour))
+		mustCreate(t, s, event)
+		events = append(events, event)
+	}
+	return events
+}
+
+func testFindOld(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	boundary := time.Now().Add(-365 * 24 * time.Hour).Truncate(time.Microsecond)
+	before, err := s.CountOlderThan(ctx, boundary)
+	require.NoError(t, err)
+
+	old := newOldEvents(t, s, boundary, 3)
+
+	atBoundary := NewEvent()
+	atBoundary.DateTime = &boundary
+	mustCreate(t, s, atBoundary)
+
+	recent := NewEvent()
+	mustCreate(t, s, recent)
+
+	events, err := s.FindOlderThan(ctx, boundary, before+10)
+	require.NoError(t, err)
+	found := ids(events)
+	for _, e := range old {
+		require.Contains(t, found, e.ID)
+	}
+	require.NotContains(t, found, atBoundary.ID)
+	require.NotContains(t, found, recent.ID)
+	for i := 1; i < len(events); i++ {
+		require.False(t, events[i].DateTime.Before(*events[i-1].DateTime), "the oldest events come first")
+	}
+
+	events, err = s.FindOlderThan(ctx, boundary, 2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	count, err := s.CountOlderThan(ctx, boundary)
+	require.NoError(t, err)
+	require.Equal(t, before+len(old), count)
+}
+
+func testDeleteByIDs(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	boundary := time.Now().Add(-365 * 24 * time.Hour).Truncate(time.Microsecond)
+	before, err := s.CountOlderThan(ctx, boundary)
+	require.NoError(t, err)
+	old := newOldEvents(t, s, boundary, 3)
+	kept := NewEvent()
+	mustCreate(t, s, kept)
+
+	deleted, err := s.DeleteByIDs(ctx, append(ids(old), uuid.New()))
+	require.NoError(t, err)
+	require.Equal(t, len(old), deleted, "unknown ids are skipped")
+	for _, e := range old {
+		_, err := s.GetByID(ctx, e.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFoundErr)
+	}
+	mustGet(t, s, kept.ID)
+
+	count, err := s.CountOlderThan(ctx, boundary)
+	require.NoError(t, err)
+	require.Equal(t, before, count)
+
+	deleted, err = s.DeleteByIDs(ctx, nil)
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+}
+
+func testConcurrent(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	const workers = 8
+	userID := uuid.New()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*4)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			event := NewEvent()
+			event.UserID = &userID
+			errs <- s.Create(ctx, event)
+			errs <- s.Update(ctx, storage.Event{ID: event.ID, Title: ptr("updated")})
+			_, err := s.GetEventsByUserID(ctx, userID)
+			errs <- err
+			_, err = s.GetByID(ctx, event.ID)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	events, err := s.GetEventsByUserID(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, events, workers)
+	for _, e := range events {
+		require.Equal(t, "updated", *e.Title)
+	}
+}
+
+func testTxCommit(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	created, updated, deleted := NewEvent(), NewEvent(), NewEvent()
+	mustCreate(t, s, updated)
+	mustCreate(t, s, deleted)
+
+	err := s.WithTx(ctx, func(tx storage.Repository) error {
+		if err := tx.Create(ctx, created); err != nil {
+			return err
+		}
+		if err := tx.Update(ctx, storage.Event{ID: updated.ID, Title: ptr("updated")}); err != nil {
+			return err
+		}
+		return tx.Delete(ctx, deleted.ID)
+	})
+	require.NoError(t, err)
+
+	mustGet(t, s, created.ID)
+	require.Equal(t, "updated", *mustGet(t, s, updated.ID).Title)
+	_, err = s.GetByID(ctx, deleted.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFoundErr)
+}
+
+func testTxRollback(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	created, updated, deleted := NewEvent(), NewEvent(), NewEvent()
+	mustCreate(t, s, updated)
+	mustCreate(t, s, deleted)
+	errAbort := errors.New("abort")
+
+	err := s.WithTx(ctx, func(tx storage.Repository) error {
+		require.NoError(t, tx.Create(ctx, created))
+		require.NoError(t, tx.Update(ctx, storage.Event{ID: updated.ID, Title: ptr("updated")}))
+		require.NoError(t, tx.Delete(ctx, deleted.ID))
+		return errAbort
+	})
+	require.ErrorIs(t, err, errAbort)
+
+	_, err = s.GetByID(ctx, created.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFoundErr)
+	require.Equal(t, *updated.Title, *mustGet(t, s, updated.ID).Title)
+	mustGet(t, s, deleted.ID)
+}
+
+func testTxPanic(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	created := NewEvent()
+
+	require.Panics(t, func() {
+		_ = s.WithTx(ctx, func(tx storage.Repository) error {
+			require.NoError(t, tx.Create(ctx, created))
+			panic("abort")
+		})
+	})
+
+	// The transaction is rolled back and its connection is released for the next one.
+	_, err := s.GetByID(ctx, created.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFoundErr)
+	require.NoError(t, s.WithTx(ctx, func(tx storage.Repository) error {
+		return tx.Create(ctx, NewEvent())
+	}))
+}
+
+func testTxReadOwnChanges(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	created, updated, deleted := NewEvent(), NewEvent(), NewEvent()
+	updated.UserID = created.UserID
+	deleted.UserID = created.UserID
+	mustCreate(t, s, updated)
+	mustCreate(t, s, deleted)
+
+	err := s.WithTx(ctx, func(tx storage.Repository) error {
+		require.NoError(t, tx.Create(ctx, created))
+		require.NoError(t, tx.Update(ctx, storage.Event{ID: updated.ID, Title: ptr("updated")}))
+		require.NoError(t, tx.Delete(ctx, deleted.ID))
+
+		got, err := tx.GetByID(ctx, updated.ID)
+		require.NoError(t, err)
+		require.Equal(t, "updated", *got.Title)
+		_, err = tx.GetByID(ctx, deleted.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFoundErr)
+		events, err := tx.GetEventsByUserID(ctx, *created.UserID)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []uuid.UUID{created.ID, updated.ID}, ids(events))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+// testTxConcurrent increments a counter kept in the title, lost updates show up as a smaller count.
+func testTxConcurrent(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	const workers = 4
+	event := NewEvent()
+	event.Title = ptr("0")
+	mustCreate(t, s, event)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.WithTx(ctx, func(tx storage.Repository) error {
+				e, err := tx.GetByID(ctx, event.ID)
+				if err != nil {
+					return err
+				}
+				n, err := strconv.Atoi(*e.Title)
+				if err != nil {
+					return err
+				}
+				return tx.Update(ctx, storage.Event{ID: event.ID, Title: ptr(strconv.Itoa(n + 1))})
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, strconv.Itoa(workers), *mustGet(t, s, event.ID).Title)
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownField     = errors.New("unknown event field")
+	ErrFieldNotNullable = errors.New("event field can not be cleared")
+)
+
+// Field is an event column that can be addressed by a partial update.
+type Field string
+
+const (
+	FieldUserID             Field = "user_id"
+	FieldTitle              Field = "title"
+	FieldDateTime           Field = "date_time"
+	FieldEventDuration      Field = "event_duration"
+	FieldDescription        Field = "description"
+	FieldNotificationTime   Field = "notification_time"
+	FieldNotificationStatus Field = "notification_status"
+	// FieldNotificationClaimedAt is not exposed by the API, it is written by the scheduler.
+	FieldNotificationClaimedAt Field = "notification_claimed_at"
+)
+
+var allFields = []Field{
+	FieldUserID,
+	FieldTitle,
+	FieldDateTime,
+	FieldEventDuration,
+	FieldDescription,
+	FieldNotificationTime,
+	FieldNotificationStatus,
+	FieldNotificationClaimedAt,
+}
+
+func (f Field) Nullable() bool {
+	switch f { //nolint:exhaustive
+	case FieldDescription, FieldNotificationTime, FieldNotificationStatus, FieldNotificationClaimedAt:
+		return true
+	default:
+		return false
+	}
+}
+
+// Changes resolves the columns written by an update.
+// Without fields every non-nil value of update is taken, so nothing can be cleared.
+// With fields exactly the listed columns are written and nil values clear nullable columns.
+// Setting or clearing the notification time resets its status unless the status is updated too,
+// changing the status clears the claim unless the claim is updated too.
+func Changes(update Event, fields ...Field) (map[Field]any, error) {
+	changes := make(map[Field]any)
+	if len(fields) == 0 {
+		for _, f := range allFields {
+			if v := update.value(f); !isNil(v) {
+				changes[f] = v
+			}
+		}
+	} else {
+		for _, f := range fields {
+			v := update.value(f)
+			if v == nil {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownField, f)
+			}
+			if isNil(v) && !f.Nullable() {
+				return nil, fmt.Errorf("%w: %s", ErrFieldNotNullable, f)
+			}
+			changes[f] = v
+		}
+	}
+	notificationTime, ok := changes[FieldNotificationTime]
+	if _, hasStatus := changes[FieldNotificationStatus]; ok && !hasStatus {
+		var status *string
+		if !isNil(notificationTime) {
+			pending := "PENDING"
+			status = &pending
+		}
+		changes[FieldNotificationStatus] = status
+	}
+	_, hasStatus := changes[FieldNotificationStatus]
+	if _, hasClaim := changes[FieldNotificationClaimedAt]; hasStatus && !hasClaim {
+		changes[FieldNotificationClaimedAt] = (*time.Time)(nil)
+	}
+	return changes, nil
+}
+
+// Apply writes changes resolved by Changes into the event.
+func (e *Event) Apply(changes map[Field]any) {
+	for f, v := range changes {
+		switch f {
+		case FieldUserID:
+			e.UserID, _ = v.(*uuid.UUID)
+		case FieldTitle:
+			e.Title, _ = v.(*string)
+		case FieldDateTime:
+			e.DateTime, _ = v.(*time.Time)
+		case FieldEventDuration:
+			e.EventDuration, _ = v.(*time.Duration)
+		case FieldDescription:
+			e.Description, _ = v.(*string)
+		case FieldNotificationTime:
+			e.NotificationTime, _ = v.(*time.Time)
+		case FieldNotificationStatus:
+			e.NotificationStatus, _ = v.(*string)
+		case FieldNotificationClaimedAt:
+			e.NotificationClaimedAt, _ = v.(*time.Time)
+		}
+	}
+}
+
+func (e Event) value(f Field) any {
+	switch f {
+	case FieldUserID:
+		return e.UserID
+	case FieldTitle:
+		return e.Title
+	case FieldDateTime:
+		return e.DateTime
+	case FieldEventDuration:
+		return e.EventDuration
+	case FieldDescription:
+		return e.Description
+	case FieldNotificationTime:
+		return e.NotificationTime
+	case FieldNotificationStatus:
+		return e.NotificationStatus
+	case FieldNotificationClaimedAt:
+		return e.NotificationClaimedAt
+	default:
+		return nil
+	}
+}
+
+func isNil(v any) bool {
+	switch p := v.(type) {
+	case *uuid.UUID:
+		return p == nil
+	case *string:
+		return p == nil
+	case *time.Time:
+		return p == nil
+	case *time.Duration:
+		return p == nil
+	default:
+		return v == nil
+	}
+}
@@ -1,6 +1,3 @@
-//go:build migrations
-// +build migrations
-
 package migrations
 
 import (
@@ -21,6 +21,12 @@ func Up00002(ctx context.Context, tx *sql.Tx) error {
 	return err
 }
 
-func Down00002(_ context.Context, _ *sql.Tx) error {
-	return nil
+func Down00002(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+						ALTER TABLE events
+						DROP COLUMN IF EXISTS notification_status;
+
+						DROP TYPE IF EXISTS notification_status;
+					`)
+	return err
 }
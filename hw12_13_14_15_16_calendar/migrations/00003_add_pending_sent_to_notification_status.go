@@ -18,6 +18,18 @@ func Up00003(ctx context.Context, tx *sql.Tx) error {
 	return err
 }
 
-func Down00003(_ context.Context, _ *sql.Tx) error {
-	return nil
+// Down00003 recreates the type without PENDING_SENT, postgres cannot drop an enum value.
+// Notifications in PENDING_SENT were published, so they become SENT.
+func Down00003(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE events SET notification_status = 'SENT' WHERE notification_status = 'PENDING_SENT';
+
+		ALTER TYPE notification_status RENAME TO notification_status_old;
+		CREATE TYPE notification_status AS ENUM ('PENDING', 'SENT');
+		ALTER TABLE events
+		ALTER COLUMN notification_status TYPE notification_status
+		USING notification_status::text::notification_status;
+		DROP TYPE notification_status_old;
+	`)
+	return err
 }
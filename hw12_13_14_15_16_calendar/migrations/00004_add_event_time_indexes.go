@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationNoTxContext(Up00004, Down00004)
+}
+
+// Up00004 adds the indexes of the scheduler and user lookups. They are built concurrently,
+// which is not allowed in a transaction, so the table stays writable while they are built.
+func Up00004(ctx context.Context, db *sql.DB) error {
+	return execAll(ctx, db,
+		`CREATE INDEX CONCURRENTLY IF NOT EXISTS events_user_id_date_time_idx
+			ON events (user_id, date_time);`,
+		`CREATE INDEX CONCURRENTLY IF NOT EXISTS events_pending_notification_time_idx
+			ON events (notification_time) WHERE notification_status = 'PENDING';`,
+		`CREATE INDEX CONCURRENTLY IF NOT EXISTS events_date_time_idx
+			ON events (date_time);`,
+	)
+}
+
+func Down00004(ctx context.Context, db *sql.DB) error {
+	return execAll(ctx, db,
+		`DROP INDEX CONCURRENTLY IF EXISTS events_date_time_idx;`,
+		`DROP INDEX CONCURRENTLY IF EXISTS events_pending_notification_time_idx;`,
+		`DROP INDEX CONCURRENTLY IF EXISTS events_user_id_date_time_idx;`,
+	)
+}
+
+func execAll(ctx context.Context, db *sql.DB, statements ...string) error {
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(Up00005, Down00005)
+}
+
+// Up00005 notifies the events_changed channel with the id of every updated or deleted event,
+// the notification is delivered when the transaction commits. Replicas caching events listen to it.
+func Up00005(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		CREATE FUNCTION notify_event_changed() RETURNS trigger AS $$
+		BEGIN
+			PERFORM pg_notify('events_changed', OLD.id::text);
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE TRIGGER events_changed
+		AFTER UPDATE OR DELETE ON events
+		FOR EACH ROW EXECUTE FUNCTION notify_event_changed();
+	`)
+	return err
+}
+
+func Down00005(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		DROP TRIGGER IF EXISTS events_changed ON events;
+		DROP FUNCTION IF EXISTS notify_event_changed();
+	`)
+	return err
+}
@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(Up00006, Down00006)
+}
+
+func Up00006(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TYPE notification_status ADD VALUE 'EXPIRED';
+	`)
+	return err
+}
+
+// Down00006 recreates the type without EXPIRED like Down00003. Expired notifications were never
+// published, so they become PENDING. The partial index compares with the type, it is recreated as well.
+func Down00006(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE events SET notification_status = 'PENDING' WHERE notification_status = 'EXPIRED';
+		DROP INDEX IF EXISTS events_pending_notification_time_idx;
+
+		ALTER TYPE notification_status RENAME TO notification_status_old;
+		CREATE TYPE notification_status AS ENUM ('PENDING', 'SENT', 'PENDING_SENT');
+		ALTER TABLE events
+		ALTER COLUMN notification_status TYPE notification_status
+		USING notification_status::text::notification_status;
+		DROP TYPE notification_status_old;
+
+		CREATE INDEX events_pending_notification_time_idx ON events (notification_time)
+		WHERE notification_status = 'PENDING';
+	`)
+	return err
+}
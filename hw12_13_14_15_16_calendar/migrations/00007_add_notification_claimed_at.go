@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(Up00007, Down00007)
+}
+
+// Up00007 adds the time the scheduler claimed a notification, it is cleared once the notification
+// is published. Claims left by a crashed scheduler are found by the partial index.
+func Up00007(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE events ADD COLUMN notification_claimed_at TIMESTAMPTZ;
+		CREATE INDEX events_notification_claimed_at_idx ON events (notification_claimed_at)
+		WHERE notification_claimed_at IS NOT NULL;
+	`)
+	return err
+}
+
+func Down00007(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		ALTER TABLE events DROP COLUMN notification_claimed_at;
+	`)
+	return err
+}
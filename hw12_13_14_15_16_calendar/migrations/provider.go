@@ -0,0 +1,45 @@
+// Package migrations holds the postgres schema of the calendar, the migrations are compiled into the binaries.
+package migrations
+
+import (
+	"database/sql"
+	"text/template"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// NewProvider returns a provider of the migrations for db. Every run holds a postgres advisory lock,
+// so binaries started at once apply the migrations one after another.
+func NewProvider(db *sql.DB) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, nil, goose.WithSessionLocker(locker))
+}
+
+// Template is the file created for a new migration, it follows the naming of the existing ones.
+var Template = template.Must(template.New("migration").Parse(`package migrations
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(Up{{.Version}}, Down{{.Version}})
+}
+
+func Up{{.Version}}(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, ` + "``" + `)
+	return err
+}
+
+func Down{{.Version}}(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, ` + "``" + `)
+	return err
+}
+`))
@@ -0,0 +1,77 @@
+//go:build migrations
+// +build migrations
+
+package integration_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/stdlib"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/leader"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/logger"
+	sqlstorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/sql"
+)
+
+func TestLeaderElectionFailover(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.NewCalendarConfig("../../configs/calendar_config.yaml")
+
+	postgresContainer, connStr := upPostgres(ctx, cfg)
+	require.NotNil(t, postgresContainer, "failed to start postgres container")
+	t.Cleanup(func() {
+		_ = testcontainers.TerminateContainer(postgresContainer)
+	})
+
+	const interval = 100 * time.Millisecond
+	type replica struct {
+		election *leader.Election
+		stop     context.CancelFunc
+		done     chan struct{}
+	}
+	replicas := make([]replica, 2)
+	for i := range replicas {
+		s := sqlstorage.New(connStr, cfg.DB, logger.New())
+		require.NoError(t, s.Connect(ctx))
+		t.Cleanup(func() { _ = s.Close() })
+
+		ctx, cancel := context.WithCancel(ctx)
+		r := replica{election: leader.New("test", logger.New()), stop: cancel, done: make(chan struct{})}
+		go func() {
+			defer close(r.done)
+			r.election.Run(ctx, s, interval)
+		}()
+		replicas[i] = r
+	}
+	t.Cleanup(func() {
+		for _, r := range replicas {
+			r.stop()
+			<-r.done
+		}
+	})
+
+	leaders := func() []int {
+		var result []int
+		for i, r := range replicas {
+			if r.election.IsLeader(ctx) == nil {
+				result = append(result, i)
+			}
+		}
+		return result
+	}
+	require.Eventually(t, func() bool { return len(leaders()) == 1 }, 5*time.Second, interval)
+	require.Never(t, func() bool { return len(leaders()) != 1 }, 5*interval, interval/2, "exactly one replica leads")
+
+	// The leader stops, its session ends and the other replica takes over.
+	first := leaders()[0]
+	replicas[first].stop()
+	<-replicas[first].done
+	require.Eventually(t, func() bool {
+		l := leaders()
+		return len(l) == 1 && l[0] != first
+	}, 5*time.Second, interval)
+}
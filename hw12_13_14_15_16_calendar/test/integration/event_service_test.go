@@ -22,6 +22,7 @@ import (
 	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/service"
 	sqlstorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/sql"
 	_ "github.com/timutkin/otus-go/hw12_13_14_15_calendar/migrations"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -48,7 +49,7 @@ var _ = Describe("EventService", Ordered, func() {
 		}}
 
 		lg = logger.New()
-		sql := sqlstorage.New(connStr, cfg.DB)
+		sql := sqlstorage.New(connStr, cfg.DB, logger.New())
 		err := sql.Connect(context.Background())
 		if err != nil {
 			log.Printf("Connection string: %s", connStr)
@@ -187,6 +188,24 @@ var _ = Describe("EventService", Ordered, func() {
 			g.Expect(resp.Event.Description).Should(g.Equal(updatedDescription))
 		}, SpecTimeout(time.Second*1))
 
+		It("should clear fields listed in update mask", func(ctx SpecContext) {
+			updatedTitle := "Masked Title"
+			updateReq := &pb.UpdateEventRequest{
+				Id:         createdEventID,
+				Title:      &updatedTitle,
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"title", "description"}},
+			}
+
+			resp, err := eventService.UpdateEvent(context.Background(), updateReq)
+			g.Expect(err).Should(g.BeNil())
+			g.Expect(resp.Event.Title).Should(g.Equal(updatedTitle))
+			g.Expect(resp.Event.Description).Should(g.BeEmpty())
+
+			event, err := storage.GetByID(context.Background(), uuid.MustParse(createdEventID))
+			g.Expect(err).Should(g.BeNil())
+			g.Expect(event.Description).Should(g.BeNil())
+		}, SpecTimeout(time.Second*1))
+
 		AfterEach(func() {
 			events, _ := storage.GetEventsByUserID(context.Background(), uuid.MustParse(eventRq.Event.UserId))
 			for _, event := range events {
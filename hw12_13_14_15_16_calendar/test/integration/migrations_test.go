@@ -0,0 +1,57 @@
+//go:build migrations
+// +build migrations
+
+package integration_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "github.com/jackc/pgx/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/migrations"
+)
+
+func TestMigrationsRollBack(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.NewCalendarConfig("../../configs/calendar_config.yaml")
+
+	postgresContainer, connStr := upPostgres(ctx, cfg)
+	require.NotNil(t, postgresContainer, "failed to start postgres container")
+	t.Cleanup(func() {
+		_ = testcontainers.TerminateContainer(postgresContainer)
+	})
+
+	db, err := sql.Open("pgx", connStr)
+	require.NoError(t, err)
+	provider, err := migrations.NewProvider(db)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = provider.Close() })
+
+	_, err = provider.Up(ctx)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO events (id, title, date_time, event_duration, user_id, notification_time, notification_status)
+		VALUES (gen_random_uuid(), 'title', NOW(), 1, gen_random_uuid(), NOW(), 'PENDING_SENT')`)
+	require.NoError(t, err)
+
+	// Every down migration runs and leaves a schema the up migrations apply to again.
+	_, err = provider.DownTo(ctx, 0)
+	require.NoError(t, err)
+	version, err := provider.GetDBVersion(ctx)
+	require.NoError(t, err)
+	require.Zero(t, version)
+
+	results, err := provider.Up(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, len(provider.ListSources()))
+	statuses, err := provider.Status(ctx)
+	require.NoError(t, err)
+	for _, s := range statuses {
+		require.Equal(t, goose.StateApplied, s.State, "migration %d", s.Source.Version)
+	}
+}
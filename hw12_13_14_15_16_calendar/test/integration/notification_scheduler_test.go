@@ -32,7 +32,7 @@ var _ = Describe("NotificationScheduler", Ordered, func() {
 
 	BeforeEach(func() {
 		lg = logger.New()
-		sql := sqlstorage.New(connStr, cfg.DB)
+		sql := sqlstorage.New(connStr, cfg.DB, logger.New())
 		err := sql.Connect(context.Background())
 		if err != nil {
 			log.Printf("Connection string: %s", connStr)
@@ -40,7 +40,11 @@ var _ = Describe("NotificationScheduler", Ordered, func() {
 		}
 		storage = sql
 		mockSender = MockSenderService{messages: [][]byte{}}
-		notificationScheduler = scheduler.NewNotificationScheduler(storage, &mockSender, lg, "test-queue")
+		notificationScheduler = scheduler.NewNotificationScheduler(storage, &mockSender, lg, "test-queue", scheduler.Settings{
+			GraceWindow:     15 * time.Minute,
+			Retention:       365 * 24 * time.Hour,
+			DeleteBatchSize: 500,
+		})
 	})
 
 	When("create notification scheduler", func() {
@@ -49,22 +53,23 @@ var _ = Describe("NotificationScheduler", Ordered, func() {
 		}, SpecTimeout(time.Second*1))
 	})
 
-	When("get scheduler jobs", func() {
-		It("should return jobs list with two jobs", func(ctx SpecContext) {
-			jobs := notificationScheduler.GetJobs()
-			g.Expect(jobs).Should(g.HaveLen(2))
+	When("register scheduler jobs", func() {
+		It("should schedule the jobs of the shipped config", func(ctx SpecContext) {
+			s := scheduler.NewScheduler(logger.New(), nil, 0)
+			notificationScheduler.Register(s)
+			schedulerCfg := config.NewSchedulerConfig("../../configs/calendar_scheduler_config.yaml")
+			definitions := make([]scheduler.JobDefinition, 0, len(schedulerCfg.Jobs))
+			for _, j := range schedulerCfg.Jobs {
+				definitions = append(definitions, scheduler.JobDefinition(j))
+			}
+			g.Expect(s.Apply(definitions)).Should(g.Succeed())
 		}, SpecTimeout(time.Second*1))
 
-		It("should have correct cron expressions", func(ctx SpecContext) {
-			jobs := notificationScheduler.GetJobs()
-			g.Expect(jobs[0].Cron).Should(g.Equal("* * * * *"))
-			g.Expect(jobs[1].Cron).Should(g.Equal("0 0 * * *"))
-		}, SpecTimeout(time.Second*1))
-
-		It("should have callable functions", func(ctx SpecContext) {
-			jobs := notificationScheduler.GetJobs()
-			g.Expect(jobs[0].Function).ShouldNot(g.BeNil())
-			g.Expect(jobs[1].Function).ShouldNot(g.BeNil())
+		It("should refuse unknown jobs", func(ctx SpecContext) {
+			s := scheduler.NewScheduler(logger.New(), nil, 0)
+			notificationScheduler.Register(s)
+			err := s.Apply([]scheduler.JobDefinition{{Name: "unknown", Enabled: true, Cron: "* * * * *"}})
+			g.Expect(err).Should(g.MatchError(scheduler.ErrUnknownJob))
 		}, SpecTimeout(time.Second*1))
 	})
 
@@ -81,7 +86,7 @@ type MockSenderService struct {
 	messages [][]byte
 }
 
-func (m *MockSenderService) Send(queueName string, message []byte) error {
+func (m *MockSenderService) Send(_ context.Context, queueName string, message []byte) error {
 	m.messages = append(m.messages, message)
 	return nil
 }
@@ -0,0 +1,99 @@
+//go:build migrations
+// +build migrations
+
+package integration_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/client"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/logger"
+)
+
+func upRabbit(
+	ctx context.Context, t *testing.T, queueName string,
+) (*testcontainers.DockerContainer, *client.RabbitClient) {
+	t.Helper()
+	rabbitContainer, err := testcontainers.Run(ctx, "rabbitmq:3.13-alpine",
+		testcontainers.WithExposedPorts("5672/tcp"),
+		testcontainers.WithWaitStrategy(wait.ForLog("Server startup complete")),
+	)
+	t.Cleanup(func() {
+		_ = testcontainers.TerminateContainer(rabbitContainer)
+	})
+	require.NoError(t, err, "failed to start rabbitmq container")
+	endpoint, err := rabbitContainer.PortEndpoint(ctx, "5672/tcp", "amqp")
+	require.NoError(t, err)
+
+	c := client.NewRabbitClient(config.Rabbit{ConnectionString: endpoint, QueueName: queueName}, logger.New())
+	t.Cleanup(func() { _ = c.Close() })
+	return rabbitContainer, c
+}
+
+func receive(t *testing.T, messages <-chan amqp.Delivery) amqp.Delivery {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		require.NoError(t, msg.Ack(false))
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message delivered")
+		return amqp.Delivery{}
+	}
+}
+
+func TestRabbitClientReconnects(t *testing.T) {
+	ctx := context.Background()
+	const queueName = "reconnect"
+	rabbitContainer, c := upRabbit(ctx, t, queueName)
+
+	// Publishing declares the queue.
+	require.NoError(t, c.Send(ctx, queueName, []byte(`{"id":"first"}`)))
+	messages, err := c.Consume(queueName, 1)
+	require.NoError(t, err)
+	require.Equal(t, `{"id":"first"}`, string(receive(t, messages).Body))
+
+	code, _, err := rabbitContainer.Exec(ctx, []string{"rabbitmqctl", "close_all_connections", "test"})
+	require.NoError(t, err)
+	require.Zero(t, code)
+	require.Eventually(t, func() bool {
+		_, ok := <-messages
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond, "the delivery channel closes with the connection")
+
+	require.Eventually(t, func() bool {
+		messages, err = c.Consume(queueName, 1)
+		return err == nil
+	}, 10*time.Second, 100*time.Millisecond, "the queue is consumed again over a new connection")
+	require.NoError(t, c.Ping(ctx))
+	require.NoError(t, c.Send(ctx, queueName, []byte(`{"id":"second"}`)))
+	require.Equal(t, `{"id":"second"}`, string(receive(t, messages).Body))
+}
+
+func TestRabbitClientDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	const queueName = "poison"
+	_, c := upRabbit(ctx, t, queueName)
+
+	require.NoError(t, c.Send(ctx, queueName, []byte("not json")))
+	messages, err := c.Consume(queueName, 1)
+	require.NoError(t, err)
+	msg := <-messages
+	// DeadLetter returns after the broker confirmed the copy, the original can be acknowledged.
+	require.NoError(t, c.DeadLetter(ctx, queueName, msg, errors.New("unmarshal notification")))
+	require.NoError(t, msg.Ack(false))
+
+	dead, err := c.Consume(client.DeadLetterQueue(queueName), 1)
+	require.NoError(t, err)
+	got := receive(t, dead)
+	require.Equal(t, "not json", string(got.Body))
+	require.Equal(t, "unmarshal notification", got.Headers[client.ErrorHeader])
+}
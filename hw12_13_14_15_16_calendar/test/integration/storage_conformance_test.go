@@ -0,0 +1,38 @@
+//go:build migrations
+// +build migrations
+
+package integration_test
+
+import (
+	"context"
+	"testing"
+
+	_ "github.com/jackc/pgx/stdlib"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/config"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/logger"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage"
+	sqlstorage "github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/sql"
+	"github.com/timutkin/otus-go/hw12_13_14_15_calendar/internal/storage/storagetest"
+	_ "github.com/timutkin/otus-go/hw12_13_14_15_calendar/migrations"
+)
+
+func TestSQLStorageConformance(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.NewCalendarConfig("../../configs/calendar_config.yaml")
+
+	postgresContainer, connStr := upPostgresAndGoMigrate(ctx, cfg)
+	require.NotNil(t, postgresContainer, "failed to start postgres container")
+	t.Cleanup(func() {
+		_ = testcontainers.TerminateContainer(postgresContainer)
+	})
+
+	sql := sqlstorage.New(connStr, cfg.DB, logger.New())
+	require.NoError(t, sql.Connect(ctx))
+	t.Cleanup(func() { _ = sql.Close() })
+
+	storagetest.Run(t, func(*testing.T) storage.Storage {
+		return sql
+	})
+}